@@ -7,7 +7,6 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"log"
 	"net"
 	"net/http"
 	"sync"
@@ -24,9 +23,12 @@ type Call struct {
 	Reply         interface{}
 	Error         error
 	Done          chan *Call //实现异步调用，调用完成后通知调用方
+	Metadata      Metadata   //随请求发送的元数据
+	span          *Span      //GoContext创建的客户端span，调用完成时结束
 }
 
 func (call *Call) done() {
+	call.span.Finish(call.Error)
 	call.Done <- call
 }
 
@@ -42,6 +44,11 @@ type Client struct {
 	pending  map[uint64]*Call //pending 存储未处理完的请求，键是编号，值是 Call 实例
 	closing  bool             // user has called Close
 	shutdown bool             // server has told us to stop
+	err      error            //导致连接不可用的第一个错误
+
+	lastRecv int64         //最后一次收到数据的时间，UnixNano，用于keepalive
+	pongs    chan struct{} //读循环收到ping后交给pongLoop回复
+	done     chan struct{} //读循环退出时关闭
 }
 
 // 断言client实现了closer接口
@@ -66,6 +73,13 @@ func (client *Client) IsAvailable() bool {
 	return !client.shutdown && !client.closing
 }
 
+// Pending 返回已经发送、还没有收到响应的调用数
+func (client *Client) Pending() int {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	return len(client.pending)
+}
+
 // 注册调用请求，返回唯一序号
 func (client *Client) registerCall(call *Call) (uint64, error) {
 	client.mu.Lock()
@@ -94,9 +108,13 @@ func (client *Client) terminateCalls(err error) {
 	client.mu.Lock()
 	defer client.mu.Unlock()
 	client.shutdown = true
-	for _, call := range client.pending {
-		call.Error = err
+	if client.err == nil {
+		client.err = err
+	}
+	for seq, call := range client.pending {
+		call.Error = client.err
 		call.done()
+		delete(client.pending, seq)
 	}
 }
 
@@ -123,25 +141,34 @@ func NewClient(conn net.Conn, opt *Option) (*Client, error) {
 	f := codec.NewCodeFuncMap[opt.CodecType]
 	if f == nil {
 		err := fmt.Errorf("invalid codec type %s", opt.CodecType)
-		log.Println("rpc client: get codec error:", err)
+		opt.logger().Error("rpc client: get codec error", "err", err)
 		return nil, err
 	}
 
 	//发送初始的option给server,采用json编码
 	if err := json.NewEncoder(conn).Encode(opt); err != nil {
-		log.Println("rpc client : json encode error")
+		opt.logger().Error("rpc client: json encode option error", "err", err)
 		_ = conn.Close()
 		return nil, err
 	}
 
 	client := &Client{
-		cc:      f(conn),
-		opt:     opt,
-		seq:     1, //0表示invalid,从1开始
-		pending: make(map[uint64]*Call),
+		cc:       f(conn),
+		opt:      opt,
+		seq:      1, //0表示invalid,从1开始，心跳帧使用0
+		pending:  make(map[uint64]*Call),
+		lastRecv: time.Now().UnixNano(),
+		pongs:    make(chan struct{}, 1),
+		done:     make(chan struct{}),
 	}
 
 	go client.receive() //开启goroutine接收请求
+	go pongLoop(client.pongs, client.done, func() error {
+		return client.sendFrame(pongMethod)
+	})
+	if opt.KeepaliveInterval > 0 {
+		go client.keepalive()
+	}
 	return client, nil
 }
 
@@ -155,6 +182,15 @@ func (client *Client) receive() {
 		if err != nil {
 			break
 		}
+		client.received()
+
+		//心跳帧：收到ping回复pong，收到pong只需要更新lastRecv
+		if isKeepalive(&h) {
+			if err = client.cc.ReadBody(nil); err == nil && h.ServiceMethod == pingMethod {
+				replyPong(client.pongs)
+			}
+			continue
+		}
 
 		call := client.removeCall(h.Seq)
 		switch {
@@ -164,7 +200,7 @@ func (client *Client) receive() {
 
 		//call存在，但服务端处理出问题了
 		case h.Error != "":
-			call.Error = fmt.Errorf(h.Error)
+			call.Error = errorFromHeader(&h)
 			err = client.cc.ReadBody(nil)
 			call.done()
 
@@ -182,6 +218,7 @@ func (client *Client) receive() {
 
 	//如果循环中断，表明存在ReadHeader出错，终止所有请求
 	client.terminateCalls(err)
+	close(client.done)
 }
 
 type clientResult struct {
@@ -263,6 +300,7 @@ func (client *Client) send(call *Call) {
 	client.header.Seq = seq
 	client.header.ServiceMethod = call.ServiceMethod
 	client.header.Error = ""
+	client.header.Metadata = call.Metadata
 
 	//encode and send request
 	if err := client.cc.Write(&client.header, call.Args); err != nil {
@@ -275,11 +313,33 @@ func (client *Client) send(call *Call) {
 }
 
 // Go 异步调用方法，调用完成后直接返回*Call
+// 不发送元数据和追踪上下文，需要时使用GoContext
 func (client *Client) Go(serviceMethod string, args, reply interface{}, done chan *Call) *Call {
+	return client.goWithMetadata(serviceMethod, args, reply, done, nil, nil)
+}
+
+// GoContext 异步调用方法，和Call一样发送ctx中的元数据和追踪上下文，调用完成时结束客户端span
+// ctx只用于传递元数据和追踪上下文，取消ctx不会取消调用
+func (client *Client) GoContext(ctx context.Context, serviceMethod string, args, reply interface{}, done chan *Call) *Call {
+	ctx, span := client.opt.Tracer.StartSpan(ctx, serviceMethod, SpanKindClient)
+	return client.goWithMetadata(serviceMethod, args, reply, done, outgoingMetadata(ctx), span)
+}
+
+// outgoingMetadata ctx中的元数据和追踪上下文，随请求一起发送
+func outgoingMetadata(ctx context.Context) Metadata {
+	md := Metadata{}
+	if outgoing, ok := OutgoingMetadata(ctx); ok {
+		md = outgoing.Copy()
+	}
+	injectTrace(ctx, md)
+	return md
+}
+
+func (client *Client) goWithMetadata(serviceMethod string, args, reply interface{}, done chan *Call, md Metadata, span *Span) *Call {
 	if done == nil {
 		done = make(chan *Call, 10)
 	} else if cap(done) == 0 {
-		log.Println("rpc client : done channel is unbuffered")
+		client.opt.logger().Error("rpc client: done channel is unbuffered", "method", serviceMethod)
 		return nil
 	}
 
@@ -288,21 +348,26 @@ func (client *Client) Go(serviceMethod string, args, reply interface{}, done cha
 		Args:          args,
 		Reply:         reply,
 		Done:          done,
+		Metadata:      md,
+		span:          span,
 	}
 	client.send(call)
 	return call
 }
 
 // Call 同步调用方法，等待call完成
-func (client *Client) Call(ctx context.Context, serviceMethod string, args, reply interface{}) error {
+func (client *Client) Call(ctx context.Context, serviceMethod string, args, reply interface{}) (err error) {
+	ctx, span := client.opt.Tracer.StartSpan(ctx, serviceMethod, SpanKindClient)
+	defer func() { span.Finish(err) }()
+
 	//call := <-client.Go(serviceMethod, args, reply, make(chan *Call, 1)).Done
-	call := client.Go(serviceMethod, args, reply, make(chan *Call, 1))
+	call := client.goWithMetadata(serviceMethod, args, reply, make(chan *Call, 1), outgoingMetadata(ctx), nil)
 	select {
 	case c := <-call.Done:
 		return c.Error
 	case <-ctx.Done():
 		//超时的话，需要移除该call
-		call = client.removeCall(call.Seq)
+		client.removeCall(call.Seq)
 		//return fmt.Errorf("rpc client : call timeout %s", call.Error.Error())  //call.Error为空报错
 		return fmt.Errorf("rpc client : call timeout %s %d", call.ServiceMethod, call.Seq)
 	}
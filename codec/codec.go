@@ -3,9 +3,10 @@ package codec
 import "io"
 
 type Header struct {
-	ServiceMethod string //服务名和方法名，用于方法调用
-	Seq           uint64 //请求序号，用于区分不同的请求
-	Error         string //错误信息 string类型
+	ServiceMethod string            //服务名和方法名，用于方法调用
+	Seq           uint64            //请求序号，用于区分不同的请求
+	Error         string            //错误信息 string类型
+	Metadata      map[string]string //元数据，用于传递trace等上下文信息
 }
 
 // Codec 抽象出对消息体进行编解码的接口
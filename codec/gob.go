@@ -4,7 +4,6 @@ import (
 	"bufio"
 	"encoding/gob"
 	"io"
-	"log"
 )
 
 type GobCodec struct {
@@ -39,6 +38,7 @@ func (c *GobCodec) ReadBody(body interface{}) error {
 	return c.dec.Decode(body)
 }
 
+// Write 编码失败时关闭连接并返回错误，由调用方通过配置的Logger记录
 func (c *GobCodec) Write(header *Header, body interface{}) (err error) {
 	//调用 buffer.Flush() 来将 buffer 中的全部内容写入到 conn 中, 从而优化效率.
 	defer func() {
@@ -49,12 +49,10 @@ func (c *GobCodec) Write(header *Header, body interface{}) (err error) {
 	}()
 
 	if err := c.enc.Encode(header); err != nil {
-		log.Println("rpc codec: gob error encoding header:", err)
 		return err
 	}
 
 	if err := c.enc.Encode(body); err != nil {
-		log.Println("rpc codec: gob error encoding body:", err)
 		return err
 	}
 
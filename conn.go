@@ -0,0 +1,176 @@
+package goRPC
+
+import (
+	"errors"
+	"io"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// WithMaxConns 同时服务的连接数上限，超过时直接关闭新连接
+func WithMaxConns(n int) ServerOption {
+	return func(s *Server) {
+		s.maxConns = n
+	}
+}
+
+// WithMaxConnsPerIP 单个客户端IP同时建立的连接数上限
+func WithMaxConnsPerIP(n int) ServerOption {
+	return func(s *Server) {
+		s.maxConnsPerIP = n
+	}
+}
+
+// WithHandshakeTimeout 建立连接后必须在该时间内发送Option，否则关闭连接
+func WithHandshakeTimeout(d time.Duration) ServerOption {
+	return func(s *Server) {
+		s.handshakeTimeout = d
+	}
+}
+
+// WithIdleTimeout 连接上没有正在处理的请求，且超过该时间没有收到新请求时关闭连接
+func WithIdleTimeout(d time.Duration) ServerOption {
+	return func(s *Server) {
+		s.idleTimeout = d
+	}
+}
+
+// WithReadTimeout 收到请求的第一个字节之后，必须在该时间内读完请求头和请求体，等待下一个请求时不限制
+func WithReadTimeout(d time.Duration) ServerOption {
+	return func(s *Server) {
+		s.readTimeout = d
+	}
+}
+
+// WithWriteTimeout 每次写响应的超时时间，客户端不读取响应时避免一直阻塞
+func WithWriteTimeout(d time.Duration) ServerOption {
+	return func(s *Server) {
+		s.writeTimeout = d
+	}
+}
+
+var errTooManyConns = errors.New("rpc server: too many connections")
+
+// serverConn 单个连接的状态，deadline只对net.Conn生效
+type serverConn struct {
+	conn       net.Conn //底层不是net.Conn时为nil
+	remote     string
+	active     int64 //正在处理的请求数
+	lastActive int64 //最后一次收到请求或者处理完请求的时间，UnixNano
+	lastRecv   int64 //最后一次收到数据的时间，包括心跳帧
+
+	armed       int32         //读请求的循环等待下一个请求，收到数据时开始计算readTimeout
+	readTimeout time.Duration //只在读请求的goroutine中访问
+}
+
+func newServerConn(rwc io.ReadWriteCloser) *serverConn {
+	now := time.Now().UnixNano()
+	sc := &serverConn{lastActive: now, lastRecv: now}
+	if conn, ok := rwc.(net.Conn); ok {
+		sc.conn = conn
+		sc.remote = conn.RemoteAddr().String()
+	} else if c, ok := rwc.(interface{ RemoteAddr() net.Addr }); ok {
+		sc.remote = c.RemoteAddr().String()
+	}
+	return sc
+}
+
+func (sc *serverConn) setReadDeadline(d time.Duration) {
+	if sc.conn == nil || d <= 0 {
+		return
+	}
+	_ = sc.conn.SetReadDeadline(time.Now().Add(d))
+}
+
+// armReadDeadline 在读请求头之前调用，读到第一个字节时才设置deadline，空闲的连接不会因此断开
+func (sc *serverConn) armReadDeadline(d time.Duration) {
+	if sc.conn == nil || d <= 0 {
+		return
+	}
+	sc.readTimeout = d
+	atomic.StoreInt32(&sc.armed, 1)
+}
+
+// startRead 收到请求的数据，设置armReadDeadline预留的deadline
+func (sc *serverConn) startRead() {
+	if atomic.CompareAndSwapInt32(&sc.armed, 1, 0) {
+		sc.setReadDeadline(sc.readTimeout)
+	}
+}
+
+func (sc *serverConn) clearReadDeadline() {
+	atomic.StoreInt32(&sc.armed, 0)
+	if sc.conn != nil {
+		_ = sc.conn.SetReadDeadline(time.Time{})
+	}
+}
+
+func (sc *serverConn) touch() {
+	atomic.StoreInt64(&sc.lastActive, time.Now().UnixNano())
+}
+
+func (sc *serverConn) begin() {
+	atomic.AddInt64(&sc.active, 1)
+	sc.touch()
+}
+
+func (sc *serverConn) end() {
+	sc.touch()
+	atomic.AddInt64(&sc.active, -1)
+}
+
+// idle 有请求正在处理时不算空闲
+func (sc *serverConn) idle() time.Duration {
+	if atomic.LoadInt64(&sc.active) > 0 {
+		return 0
+	}
+	return time.Since(time.Unix(0, atomic.LoadInt64(&sc.lastActive)))
+}
+
+// watchIdle 连接空闲超过idleTimeout时关闭，读请求的循环会因此退出
+func (server *Server) watchIdle(sc *serverConn, closer io.Closer, done <-chan struct{}) {
+	ticker := time.NewTicker(server.idleTimeout / 4)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if sc.idle() >= server.idleTimeout {
+				server.logger.Debug("rpc server: close idle connection", "remote", sc.remote, "idle", server.idleTimeout)
+				_ = closer.Close()
+				return
+			}
+		}
+	}
+}
+
+// deadlineConn 每次写之前设置写超时，读到请求的数据时开始计算读超时
+type deadlineConn struct {
+	io.ReadWriteCloser
+	r            io.Reader //先读json解码器中剩余的数据，再读连接
+	conn         net.Conn
+	sc           *serverConn
+	writeTimeout time.Duration
+}
+
+func (c *deadlineConn) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	if n > 0 {
+		c.sc.startRead()
+	}
+	return n, err
+}
+
+func (c *deadlineConn) Write(p []byte) (int, error) {
+	if c.conn != nil && c.writeTimeout > 0 {
+		_ = c.conn.SetWriteDeadline(time.Now().Add(c.writeTimeout))
+	}
+	return c.ReadWriteCloser.Write(p)
+}
+
+func isTimeout(err error) bool {
+	var ne net.Error
+	return errors.As(err, &ne) && ne.Timeout()
+}
@@ -0,0 +1,115 @@
+package goRPC_test
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	goRPC "github.com/wjh791072385/gorpc"
+)
+
+// 等待服务端关闭连接，超时返回false
+func waitClosed(conn net.Conn, timeout time.Duration) bool {
+	_ = conn.SetReadDeadline(time.Now().Add(timeout))
+	_, err := conn.Read(make([]byte, 1))
+	if ne, ok := err.(net.Error); ok && ne.Timeout() {
+		return false
+	}
+	return err != nil
+}
+
+func TestConnLimits(t *testing.T) {
+	server := goRPC.NewServer(goRPC.WithMaxConnsPerIP(1), goRPC.WithHandshakeTimeout(50*time.Millisecond))
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	go server.Accept(l)
+	defer l.Close()
+
+	t.Run("per ip", func(t *testing.T) {
+		client, err := goRPC.Dial("tcp", l.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer client.Close()
+		var reply goRPC.HealthCheckResponse
+		if err := client.Call(context.Background(), "Health.Check", goRPC.HealthCheckRequest{}, &reply); err != nil {
+			t.Fatal(err)
+		}
+
+		conn, _ := net.Dial("tcp", l.Addr().String())
+		defer conn.Close()
+		if !waitClosed(conn, time.Second) {
+			t.Fatal("second connection from the same ip should be closed")
+		}
+	})
+
+	t.Run("handshake", func(t *testing.T) {
+		conn, _ := net.Dial("tcp", l.Addr().String())
+		defer conn.Close()
+		if !waitClosed(conn, time.Second) {
+			t.Fatal("connection without option should be closed after handshake timeout")
+		}
+	})
+}
+
+func TestIdleTimeout(t *testing.T) {
+	server := goRPC.NewServer(goRPC.WithIdleTimeout(100 * time.Millisecond))
+	var s Slow
+	_ = server.Register(&s)
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	go server.Accept(l)
+	defer l.Close()
+
+	client, err := goRPC.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	//正在处理请求时不算空闲
+	var reply int
+	if err := client.Call(context.Background(), "Slow.Wait", 300*time.Millisecond, &reply); err != nil {
+		t.Fatalf("busy connection should not be closed: %v", err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for client.IsAvailable() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if client.IsAvailable() {
+		t.Fatal("idle connection should be closed")
+	}
+}
+
+func TestReadTimeout(t *testing.T) {
+	server := goRPC.NewServer(goRPC.WithReadTimeout(100 * time.Millisecond))
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	go server.Accept(l)
+	defer l.Close()
+
+	t.Run("idle", func(t *testing.T) {
+		client, err := goRPC.Dial("tcp", l.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer client.Close()
+		//等待下一个请求时不计算读超时
+		time.Sleep(300 * time.Millisecond)
+		var reply goRPC.HealthCheckResponse
+		if err := client.Call(context.Background(), "Health.Check", goRPC.HealthCheckRequest{}, &reply); err != nil {
+			t.Fatalf("idle connection should not be closed by read timeout: %v", err)
+		}
+	})
+
+	t.Run("partial header", func(t *testing.T) {
+		conn, _ := net.Dial("tcp", l.Addr().String())
+		defer conn.Close()
+		_ = json.NewEncoder(conn).Encode(goRPC.DefaultOption)
+		//只发送请求头的第一个字节，后面的数据一直不发送
+		_, _ = conn.Write([]byte{0x20})
+		if !waitClosed(conn, time.Second) {
+			t.Fatal("connection with a partial header should be closed after read timeout")
+		}
+	})
+}
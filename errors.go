@@ -0,0 +1,109 @@
+package goRPC
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/wjh791072385/gorpc/codec"
+)
+
+// Code 错误码，服务端通过响应头的元数据传给客户端，客户端可以据此决定是否重试、退避
+type Code int
+
+const (
+	CodeOK                Code = iota
+	CodeUnknown                //未分类的错误，比如handler返回的普通error
+	CodeNotFound               //服务或方法不存在
+	CodeDeadlineExceeded       //服务端处理超时
+	CodeResourceExhausted      //超过并发限制
+	CodeUnavailable            //服务端正在关闭
+)
+
+func (c Code) String() string {
+	switch c {
+	case CodeOK:
+		return "OK"
+	case CodeNotFound:
+		return "NotFound"
+	case CodeDeadlineExceeded:
+		return "DeadlineExceeded"
+	case CodeResourceExhausted:
+		return "ResourceExhausted"
+	case CodeUnavailable:
+		return "Unavailable"
+	default:
+		return "Unknown"
+	}
+}
+
+const (
+	codeKey       = "gorpc-code"        //响应头元数据中错误码的key
+	retryAfterKey = "gorpc-retry-after" //建议客户端多久之后再重试，单位毫秒
+)
+
+// Error 带错误码的错误
+type Error struct {
+	Code       Code
+	Message    string
+	RetryAfter time.Duration //被限流时，建议客户端等待多久之后再重试
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func newError(code Code, msg string) *Error {
+	return &Error{Code: code, Message: msg}
+}
+
+// ErrorCode 返回err的错误码，nil返回CodeOK，不带错误码的返回CodeUnknown
+func ErrorCode(err error) Code {
+	if err == nil {
+		return CodeOK
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	return CodeUnknown
+}
+
+// RetryAfter 返回err中建议的重试等待时间，没有时返回0
+func RetryAfter(err error) time.Duration {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.RetryAfter
+	}
+	return 0
+}
+
+// 服务端：将错误写入响应头
+func setHeaderError(h *codec.Header, err error) {
+	h.Error = err.Error()
+	code, retryAfter := ErrorCode(err), RetryAfter(err)
+	if code == CodeUnknown && retryAfter == 0 {
+		return
+	}
+	if h.Metadata == nil {
+		h.Metadata = make(map[string]string)
+	}
+	h.Metadata[codeKey] = strconv.Itoa(int(code))
+	if retryAfter > 0 {
+		h.Metadata[retryAfterKey] = strconv.FormatInt(retryAfter.Milliseconds(), 10)
+	}
+}
+
+// 客户端：从响应头恢复错误，服务端返回的错误都是*Error，没有错误码时为CodeUnknown，
+// 可以和连接断开等本地错误区分开
+func errorFromHeader(h *codec.Header) error {
+	code, err := strconv.Atoi(h.Metadata[codeKey])
+	if err != nil {
+		return newError(CodeUnknown, h.Error)
+	}
+	e := newError(Code(code), h.Error)
+	if ms, err := strconv.ParseInt(h.Metadata[retryAfterKey], 10, 64); err == nil {
+		e.RetryAfter = time.Duration(ms) * time.Millisecond
+	}
+	return e
+}
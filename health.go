@@ -0,0 +1,138 @@
+package goRPC
+
+import (
+	"context"
+	"sync"
+)
+
+// HealthServiceName 每个Server自动注册的健康检查服务，提供 Health.Check 和 Health.Watch
+const HealthServiceName = "Health"
+
+type HealthStatus int
+
+const (
+	HealthUnknown    HealthStatus = iota //服务不存在
+	HealthServing                        //正常提供服务
+	HealthNotServing                     //暂停服务，比如正在关闭
+)
+
+func (s HealthStatus) String() string {
+	switch s {
+	case HealthServing:
+		return "SERVING"
+	case HealthNotServing:
+		return "NOT_SERVING"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// HealthCheckRequest Service为空表示查询整个Server的状态
+type HealthCheckRequest struct {
+	Service string
+}
+
+type HealthCheckResponse struct {
+	Status HealthStatus
+}
+
+// HealthWatchRequest Watch会阻塞到状态与LastStatus不同时才返回
+type HealthWatchRequest struct {
+	Service    string
+	LastStatus HealthStatus
+}
+
+// Health 内置的健康检查服务，状态由应用通过 Server.SetServingStatus 设置
+type Health struct {
+	server   *Server
+	mu       sync.Mutex
+	statuses map[string]HealthStatus //应用显式设置的状态
+	shutdown bool                    //Shutdown之后所有服务都是NOT_SERVING
+	changed  chan struct{}           //状态变化时关闭并重建，用于唤醒Watch
+}
+
+func newHealth(server *Server) *Health {
+	return &Health{
+		server:   server,
+		statuses: make(map[string]HealthStatus),
+		changed:  make(chan struct{}),
+	}
+}
+
+// Check 返回服务当前的状态
+func (h *Health) Check(req HealthCheckRequest, reply *HealthCheckResponse) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	reply.Status = h.status(req.Service)
+	return nil
+}
+
+// Watch 长轮询，状态变化或者请求超时后返回当前状态
+func (h *Health) Watch(ctx context.Context, req HealthWatchRequest, reply *HealthCheckResponse) error {
+	for {
+		h.mu.Lock()
+		status, changed := h.status(req.Service), h.changed
+		h.mu.Unlock()
+
+		if status != req.LastStatus {
+			reply.Status = status
+			return nil
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			reply.Status = status
+			return nil
+		}
+	}
+}
+
+// 需要持有h.mu
+func (h *Health) status(service string) HealthStatus {
+	if h.shutdown {
+		return HealthNotServing
+	}
+	if status, ok := h.statuses[service]; ok {
+		return status
+	}
+	//未显式设置时，Server本身和已注册的服务都认为是SERVING
+	if service == "" {
+		return HealthServing
+	}
+	if _, ok := h.server.serviceMap.Load(service); ok {
+		return HealthServing
+	}
+	return HealthUnknown
+}
+
+func (h *Health) setStatus(service string, status HealthStatus) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.statuses[service] = status
+	h.notify()
+}
+
+func (h *Health) setShutdown() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.shutdown = true
+	h.notify()
+}
+
+// serviceChanged 服务注册、移除或替换后唤醒Watch，未显式设置状态的服务状态随之变化
+func (h *Health) serviceChanged() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.notify()
+}
+
+// 需要持有h.mu
+func (h *Health) notify() {
+	close(h.changed)
+	h.changed = make(chan struct{})
+}
+
+// SetServingStatus 设置服务的健康状态，service为空表示整个Server
+func (server *Server) SetServingStatus(service string, status HealthStatus) {
+	server.health.setStatus(service, status)
+}
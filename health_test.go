@@ -0,0 +1,103 @@
+package goRPC_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	goRPC "github.com/wjh791072385/gorpc"
+)
+
+func checkHealth(t *testing.T, client *goRPC.Client, service string) goRPC.HealthStatus {
+	var reply goRPC.HealthCheckResponse
+	if err := client.Call(context.Background(), "Health.Check", goRPC.HealthCheckRequest{Service: service}, &reply); err != nil {
+		t.Fatal(err)
+	}
+	return reply.Status
+}
+
+func TestHealth(t *testing.T) {
+	server := goRPC.NewServer()
+	_ = server.RegisterName("Version", Version(1))
+	l, _ := net.Listen("tcp", ":0")
+	go server.Accept(l)
+
+	client, err := goRPC.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	if s := checkHealth(t, client, "Version"); s != goRPC.HealthServing {
+		t.Fatalf("expect SERVING, got %s", s)
+	}
+	if s := checkHealth(t, client, "Missing"); s != goRPC.HealthUnknown {
+		t.Fatalf("expect UNKNOWN, got %s", s)
+	}
+	server.SetServingStatus("Version", goRPC.HealthNotServing)
+	if s := checkHealth(t, client, "Version"); s != goRPC.HealthNotServing {
+		t.Fatalf("expect NOT_SERVING, got %s", s)
+	}
+	server.SetServingStatus("Version", goRPC.HealthServing)
+
+	//Watch阻塞直到Shutdown改变状态
+	watch := client.Go("Health.Watch", goRPC.HealthWatchRequest{Service: "Version", LastStatus: goRPC.HealthServing}, new(goRPC.HealthCheckResponse), nil)
+	time.Sleep(100 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case call := <-watch.Done:
+		if call.Error != nil || call.Reply.(*goRPC.HealthCheckResponse).Status != goRPC.HealthNotServing {
+			t.Fatalf("expect NOT_SERVING from watch, got %v", call.Error)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("watch not notified by shutdown")
+	}
+	if _, err := net.Dial("tcp", l.Addr().String()); err == nil {
+		t.Fatal("listener should be closed after shutdown")
+	}
+}
+
+// 注册和移除服务会唤醒对应服务的Watch
+func TestHealthWatchRegister(t *testing.T) {
+	server := goRPC.NewServer()
+	l, _ := net.Listen("tcp", ":0")
+	go server.Accept(l)
+	defer l.Close()
+
+	client, err := goRPC.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	tests := []struct {
+		name   string
+		last   goRPC.HealthStatus
+		change func() error
+		expect goRPC.HealthStatus
+	}{
+		{"register", goRPC.HealthUnknown, func() error { return server.RegisterName("Version", Version(1)) }, goRPC.HealthServing},
+		{"unregister", goRPC.HealthServing, func() error { return server.Unregister("Version") }, goRPC.HealthUnknown},
+	}
+	for _, tt := range tests {
+		watch := client.Go("Health.Watch", goRPC.HealthWatchRequest{Service: "Version", LastStatus: tt.last}, new(goRPC.HealthCheckResponse), nil)
+		time.Sleep(50 * time.Millisecond) //等待Watch阻塞
+		if err := tt.change(); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case call := <-watch.Done:
+			if status := call.Reply.(*goRPC.HealthCheckResponse).Status; call.Error != nil || status != tt.expect {
+				t.Fatalf("%s: expect %s from watch, got %s, err %v", tt.name, tt.expect, status, call.Error)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%s: watch not notified", tt.name)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package goRPC
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/wjh791072385/gorpc/codec"
+)
+
+// 心跳帧和普通请求使用同样的格式，Seq固定为0（正常请求从1开始），由ServiceMethod区分
+const (
+	pingMethod = "goRPC.Ping"
+	pongMethod = "goRPC.Pong"
+)
+
+// ErrKeepaliveTimeout 发送ping之后超时没有收到对端的任何数据，连接已经不可用
+var ErrKeepaliveTimeout error = newError(CodeUnavailable, "rpc: keepalive timeout")
+
+func isKeepalive(h *codec.Header) bool {
+	return h.Seq == 0 && (h.ServiceMethod == pingMethod || h.ServiceMethod == pongMethod)
+}
+
+// WithKeepalive 服务端主动探测空闲连接：超过interval没有收到数据时发送ping，
+// 再过timeout仍然没有收到数据则关闭连接。timeout为0时等于interval
+func WithKeepalive(interval, timeout time.Duration) ServerOption {
+	return func(s *Server) {
+		s.keepaliveInterval = interval
+		s.keepaliveTimeout = timeout
+	}
+}
+
+// keepaliveLoop 客户端和服务端共用的探测逻辑
+// lastRecv返回最后一次收到数据的时间，ping发送心跳，dead在对端无响应时调用
+func keepaliveLoop(interval, timeout time.Duration, done <-chan struct{}, lastRecv func() time.Time, ping func() error, dead func()) {
+	if timeout <= 0 {
+		timeout = interval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+		//最近收到过数据，说明连接正常，不需要ping
+		if time.Since(lastRecv()) < interval {
+			continue
+		}
+
+		pingAt := time.Now()
+		if err := ping(); err != nil {
+			return //写失败时读的一方也会出错，由读循环负责清理
+		}
+		select {
+		case <-done:
+			return
+		case <-time.After(timeout):
+		}
+		if lastRecv().Before(pingAt) {
+			dead()
+			return
+		}
+	}
+}
+
+// replyPong 读循环不能直接写pong：写锁可能被一个阻塞的写操作持有，
+// 而对端要等我们读取数据才能继续读，读循环等待写锁会导致两端互相等待
+// 还没来得及回复的pong只保留一个
+func replyPong(pongs chan<- struct{}) {
+	select {
+	case pongs <- struct{}{}:
+	default:
+	}
+}
+
+// pongLoop 在读循环之外回复pong，写失败时退出，由读循环负责清理
+func pongLoop(pongs <-chan struct{}, done <-chan struct{}, write func() error) {
+	for {
+		select {
+		case <-done:
+			return
+		case <-pongs:
+			if err := write(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// 服务端：记录最后一次收到数据的时间，包括心跳帧
+func (sc *serverConn) received() {
+	atomic.StoreInt64(&sc.lastRecv, time.Now().UnixNano())
+}
+
+func (sc *serverConn) lastReceived() time.Time {
+	return time.Unix(0, atomic.LoadInt64(&sc.lastRecv))
+}
+
+func (server *Server) keepalive(sc *serverConn, cc codec.Codec, sending *sync.Mutex, done <-chan struct{}) {
+	keepaliveLoop(server.keepaliveInterval, server.keepaliveTimeout, done, sc.lastReceived,
+		func() error {
+			return server.sendFrame(cc, pingMethod, sending)
+		},
+		func() {
+			server.logger.Warn("rpc server: keepalive timeout, close connection", "remote", sc.remote)
+			_ = cc.Close()
+		})
+}
+
+func (server *Server) sendFrame(cc codec.Codec, method string, sending *sync.Mutex) error {
+	sending.Lock()
+	defer sending.Unlock()
+	return cc.Write(&codec.Header{ServiceMethod: method}, invalidRequest)
+}
+
+// 客户端
+func (client *Client) received() {
+	atomic.StoreInt64(&client.lastRecv, time.Now().UnixNano())
+}
+
+func (client *Client) lastReceived() time.Time {
+	return time.Unix(0, atomic.LoadInt64(&client.lastRecv))
+}
+
+func (client *Client) sendFrame(method string) error {
+	client.sending.Lock()
+	defer client.sending.Unlock()
+	return client.cc.Write(&codec.Header{ServiceMethod: method}, invalidRequest)
+}
+
+func (client *Client) keepalive() {
+	keepaliveLoop(client.opt.KeepaliveInterval, client.opt.KeepaliveTimeout, client.done, client.lastReceived,
+		func() error {
+			return client.sendFrame(pingMethod)
+		},
+		func() {
+			client.opt.logger().Warn("rpc client: keepalive timeout, close connection", "timeout", client.opt.KeepaliveTimeout)
+			//先记录原因再关闭连接，读循环退出时用这个错误终止所有请求
+			client.mu.Lock()
+			if client.err == nil {
+				client.err = ErrKeepaliveTimeout
+			}
+			client.shutdown = true
+			client.mu.Unlock()
+			_ = client.cc.Close()
+		})
+}
@@ -0,0 +1,140 @@
+package goRPC_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/wjh791072385/gorpc/codec"
+
+	goRPC "github.com/wjh791072385/gorpc"
+)
+
+func TestClientKeepalive(t *testing.T) {
+	opt := &goRPC.Option{KeepaliveInterval: 20 * time.Millisecond, KeepaliveTimeout: 50 * time.Millisecond}
+
+	t.Run("pong", func(t *testing.T) {
+		server := goRPC.NewServer()
+		l, _ := net.Listen("tcp", "127.0.0.1:0")
+		go server.Accept(l)
+		defer l.Close()
+
+		client, err := goRPC.Dial("tcp", l.Addr().String(), opt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer client.Close()
+		time.Sleep(200 * time.Millisecond)
+		if !client.IsAvailable() {
+			t.Fatal("client should stay available when server answers pings")
+		}
+		var reply goRPC.HealthCheckResponse
+		if err := client.Call(context.Background(), "Health.Check", goRPC.HealthCheckRequest{}, &reply); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("dead peer", func(t *testing.T) {
+		//只读不写，模拟被NAT丢弃的连接
+		l, _ := net.Listen("tcp", "127.0.0.1:0")
+		defer l.Close()
+		go func() {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			_, _ = io.Copy(io.Discard, conn)
+		}()
+
+		client, err := goRPC.Dial("tcp", l.Addr().String(), opt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer client.Close()
+		call := client.Go("Foo.Sum", 1, new(int), nil)
+		select {
+		case <-call.Done:
+		case <-time.After(time.Second):
+			t.Fatal("pending call should be terminated")
+		}
+		if !errors.Is(call.Error, goRPC.ErrKeepaliveTimeout) {
+			t.Fatalf("expect keepalive timeout, got %v", call.Error)
+		}
+		if client.IsAvailable() {
+			t.Fatal("client should be unavailable")
+		}
+	})
+}
+
+func TestServerKeepalive(t *testing.T) {
+	server := goRPC.NewServer(goRPC.WithKeepalive(20*time.Millisecond, 50*time.Millisecond))
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	go server.Accept(l)
+	defer l.Close()
+
+	//发送Option之后不再回复pong
+	conn, _ := net.Dial("tcp", l.Addr().String())
+	defer conn.Close()
+	_ = json.NewEncoder(conn).Encode(goRPC.DefaultOption)
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, err := io.Copy(io.Discard, conn)
+	if ne, ok := err.(net.Error); ok && ne.Timeout() {
+		t.Fatal("server should close connection without pong")
+	}
+
+	//正常的客户端会回复pong
+	client, err := goRPC.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	time.Sleep(200 * time.Millisecond)
+	var reply goRPC.HealthCheckResponse
+	if err := client.Call(context.Background(), "Health.Check", goRPC.HealthCheckRequest{}, &reply); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// 客户端的写被阻塞时，读循环收到ping之后仍然继续读，不会和对端互相等待
+func TestClientPingWhileWriting(t *testing.T) {
+	cliConn, srvConn := net.Pipe() //没有缓冲，对端不读时写一直阻塞
+	defer srvConn.Close()
+	go func() {
+		var opt goRPC.Option
+		_ = json.NewDecoder(srvConn).Decode(&opt)
+	}()
+	client, err := goRPC.NewClient(cliConn, goRPC.DefaultOption)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	//服务端不读取请求，客户端的写阻塞并持有写锁
+	go client.Go("Foo.Sum", 1, new(int), nil)
+	time.Sleep(50 * time.Millisecond)
+
+	cc := codec.NewGobCodec(srvConn)
+	written := make(chan error, 1)
+	go func() {
+		for i := 0; i < 2; i++ {
+			if err := cc.Write(&codec.Header{ServiceMethod: "goRPC.Ping"}, struct{}{}); err != nil {
+				written <- err
+				return
+			}
+		}
+		written <- nil
+	}()
+	select {
+	case err := <-written:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("client stopped reading while replying pong")
+	}
+}
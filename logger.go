@@ -0,0 +1,97 @@
+package goRPC
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// Logger 分级的结构化日志接口，参数为 msg 加若干 key/value 对
+// 方法签名与 log/slog 的 *slog.Logger 一致，可以直接传入 slog.Default()
+type Logger interface {
+	Debug(msg string, keysAndValues ...interface{})
+	Info(msg string, keysAndValues ...interface{})
+	Warn(msg string, keysAndValues ...interface{})
+	Error(msg string, keysAndValues ...interface{})
+}
+
+type LogLevel int
+
+const (
+	LevelDebug LogLevel = iota //正常的连接关闭等信息
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+func (l LogLevel) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	default:
+		return "ERROR"
+	}
+}
+
+// DefaultLogger 未配置Logger时使用，基于标准库log，只输出Info及以上级别
+var DefaultLogger Logger = NewStdLogger(log.Default(), LevelInfo)
+
+// StdLogger 基于标准库log的实现，输出格式：INFO msg key=value ...
+type StdLogger struct {
+	l     *log.Logger
+	level LogLevel
+}
+
+var _ Logger = (*StdLogger)(nil)
+
+// NewStdLogger 低于level的日志会被丢弃
+func NewStdLogger(l *log.Logger, level LogLevel) *StdLogger {
+	return &StdLogger{l: l, level: level}
+}
+
+func (s *StdLogger) Debug(msg string, keysAndValues ...interface{}) {
+	s.output(LevelDebug, msg, keysAndValues)
+}
+
+func (s *StdLogger) Info(msg string, keysAndValues ...interface{}) {
+	s.output(LevelInfo, msg, keysAndValues)
+}
+
+func (s *StdLogger) Warn(msg string, keysAndValues ...interface{}) {
+	s.output(LevelWarn, msg, keysAndValues)
+}
+
+func (s *StdLogger) Error(msg string, keysAndValues ...interface{}) {
+	s.output(LevelError, msg, keysAndValues)
+}
+
+func (s *StdLogger) output(level LogLevel, msg string, keysAndValues []interface{}) {
+	if level < s.level {
+		return
+	}
+	var b strings.Builder
+	b.WriteString(level.String())
+	b.WriteString(" ")
+	b.WriteString(msg)
+	for i := 0; i < len(keysAndValues); i += 2 {
+		//奇数个参数时最后一个没有key，和slog一样用!BADKEY标识
+		if i+1 == len(keysAndValues) {
+			fmt.Fprintf(&b, " !BADKEY=%v", keysAndValues[i])
+			break
+		}
+		fmt.Fprintf(&b, " %v=%v", keysAndValues[i], keysAndValues[i+1])
+	}
+	_ = s.l.Output(3, b.String())
+}
+
+// 返回opt中配置的Logger，未配置时使用DefaultLogger
+func (opt *Option) logger() Logger {
+	if opt == nil || opt.Logger == nil {
+		return DefaultLogger
+	}
+	return opt.Logger
+}
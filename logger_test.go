@@ -0,0 +1,23 @@
+package goRPC
+
+import (
+	"bytes"
+	"log"
+	"testing"
+)
+
+func TestStdLogger(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewStdLogger(log.New(&buf, "", 0), LevelInfo)
+
+	l.Debug("rpc server: connection closed", "err", "EOF")
+	if buf.Len() != 0 {
+		t.Fatalf("debug log should be dropped, got %q", buf.String())
+	}
+
+	l.Warn("rpc server: invalid magic number", "magic", 1, "odd")
+	want := "WARN rpc server: invalid magic number magic=1 !BADKEY=odd\n"
+	if buf.String() != want {
+		t.Fatalf("expect %q, got %q", want, buf.String())
+	}
+}
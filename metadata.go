@@ -0,0 +1,47 @@
+package goRPC
+
+import "context"
+
+// Metadata 请求元数据，随 Header 一起在连接上传输，比如 traceparent
+type Metadata map[string]string
+
+func (md Metadata) Get(key string) string {
+	return md[key]
+}
+
+func (md Metadata) Set(key, value string) {
+	md[key] = value
+}
+
+// Copy 返回拷贝，避免多个请求共享同一个map
+func (md Metadata) Copy() Metadata {
+	out := make(Metadata, len(md))
+	for k, v := range md {
+		out[k] = v
+	}
+	return out
+}
+
+type outgoingMDKey struct{}
+type incomingMDKey struct{}
+
+// NewOutgoingContext 客户端使用，ctx中的元数据会随着Call一起发送给服务端
+func NewOutgoingContext(ctx context.Context, md Metadata) context.Context {
+	return context.WithValue(ctx, outgoingMDKey{}, md)
+}
+
+// OutgoingMetadata 返回ctx中待发送的元数据
+func OutgoingMetadata(ctx context.Context) (Metadata, bool) {
+	md, ok := ctx.Value(outgoingMDKey{}).(Metadata)
+	return md, ok
+}
+
+// MetadataFromContext 服务端使用，handler通过ctx读取客户端发来的元数据
+func MetadataFromContext(ctx context.Context) (Metadata, bool) {
+	md, ok := ctx.Value(incomingMDKey{}).(Metadata)
+	return md, ok
+}
+
+func newIncomingContext(ctx context.Context, md Metadata) context.Context {
+	return context.WithValue(ctx, incomingMDKey{}, md)
+}
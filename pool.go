@@ -0,0 +1,200 @@
+package goRPC
+
+import (
+	"container/heap"
+	"sync"
+)
+
+// semaphore 限制并发数，nil表示不限制
+type semaphore chan struct{}
+
+func newSemaphore(n int) semaphore {
+	if n <= 0 {
+		return nil
+	}
+	return make(semaphore, n)
+}
+
+// acquire block为false时不等待，返回是否获取成功
+func (s semaphore) acquire(block bool) bool {
+	if s == nil {
+		return true
+	}
+	if block {
+		s <- struct{}{}
+		return true
+	}
+	select {
+	case s <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s semaphore) release() {
+	if s != nil {
+		<-s
+	}
+}
+
+// poolTask 队列中的任务，reject在任务被挤出队列时调用
+type poolTask struct {
+	run      func()
+	reject   func()
+	priority Priority
+	seq      uint64 //相同优先级先进先出
+}
+
+// taskHeap 按优先级排序的任务队列
+type taskHeap []*poolTask
+
+func (h taskHeap) Len() int { return len(h) }
+
+func (h taskHeap) Less(i, j int) bool {
+	if h[i].priority != h[j].priority {
+		return h[i].priority > h[j].priority
+	}
+	return h[i].seq < h[j].seq
+}
+
+func (h taskHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *taskHeap) Push(x interface{}) { *h = append(*h, x.(*poolTask)) }
+
+func (h *taskHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	t := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return t
+}
+
+// lowest 返回优先级最低、最晚入队的任务下标
+func (h taskHeap) lowest() int {
+	idx := 0
+	for i := range h {
+		if h.Less(idx, i) {
+			idx = i
+		}
+	}
+	return idx
+}
+
+// workerPool 固定数量的worker从有界的优先级队列中取任务执行，优先级高的先执行
+type workerPool struct {
+	mu       sync.Mutex // protect following
+	notEmpty *sync.Cond
+	notFull  *sync.Cond
+	queue    taskHeap
+	size     int //队列长度上限
+	idle     int //正在等待任务的worker数，这些worker可以立即取走任务，不占用队列
+	seq      uint64
+	closed   bool
+
+	wg sync.WaitGroup
+}
+
+func newWorkerPool(workers, queueSize int) *workerPool {
+	p := &workerPool{size: queueSize}
+	p.notEmpty = sync.NewCond(&p.mu)
+	p.notFull = sync.NewCond(&p.mu)
+	p.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go p.worker()
+	}
+	return p
+}
+
+func (p *workerPool) worker() {
+	defer p.wg.Done()
+	for {
+		p.mu.Lock()
+		for len(p.queue) == 0 && !p.closed {
+			p.idle++
+			p.notEmpty.Wait()
+			p.idle--
+		}
+		if len(p.queue) == 0 {
+			//已经关闭，且队列中的任务都执行完了
+			p.mu.Unlock()
+			return
+		}
+		t := heap.Pop(&p.queue).(*poolTask)
+		p.notFull.Signal()
+		p.mu.Unlock()
+
+		t.run()
+	}
+}
+
+func (p *workerPool) full() bool {
+	return len(p.queue) >= p.size+p.idle
+}
+
+// submit 队列满时，block为true则等待；否则如果队列中有优先级更低的任务，挤掉其中最低的那个，
+// 没有则返回false。被挤掉的任务会调用它的reject
+func (p *workerPool) submit(run, reject func(), priority Priority, block bool) bool {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return false
+	}
+
+	var evicted *poolTask
+	for p.full() {
+		if !block {
+			if len(p.queue) == 0 {
+				p.mu.Unlock()
+				return false
+			}
+			idx := p.queue.lowest()
+			if p.queue[idx].priority >= priority {
+				p.mu.Unlock()
+				return false
+			}
+			evicted = heap.Remove(&p.queue, idx).(*poolTask)
+			break
+		}
+		p.notFull.Wait()
+		if p.closed {
+			p.mu.Unlock()
+			return false
+		}
+	}
+
+	p.seq++
+	heap.Push(&p.queue, &poolTask{run: run, reject: reject, priority: priority, seq: p.seq})
+	p.notEmpty.Signal()
+	p.mu.Unlock()
+
+	if evicted != nil {
+		evicted.reject()
+	}
+	return true
+}
+
+// stop 执行完队列中剩余的任务后退出所有worker
+func (p *workerPool) stop() {
+	p.mu.Lock()
+	p.closed = true
+	p.notEmpty.Broadcast()
+	p.notFull.Broadcast()
+	p.mu.Unlock()
+	p.wg.Wait()
+}
+
+// abort 拒绝队列中剩余的任务，不等待正在执行的任务，用于Shutdown超时
+func (p *workerPool) abort() {
+	p.mu.Lock()
+	p.closed = true
+	queued := p.queue
+	p.queue = nil
+	p.notEmpty.Broadcast()
+	p.notFull.Broadcast()
+	p.mu.Unlock()
+	for _, t := range queued {
+		t.reject()
+	}
+}
@@ -0,0 +1,72 @@
+package goRPC
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestWorkerPoolPriority(t *testing.T) {
+	p := newWorkerPool(1, 2)
+
+	//占住唯一的worker，后面的任务都进入队列
+	gate := make(chan struct{})
+	started := make(chan struct{})
+	p.submit(func() { close(started); <-gate }, nil, PriorityNormal, false)
+	<-started
+
+	var mu sync.Mutex
+	var order, rejected []string
+	task := func(name string, priority Priority) bool {
+		return p.submit(func() {
+			mu.Lock()
+			order = append(order, name)
+			mu.Unlock()
+		}, func() {
+			mu.Lock()
+			rejected = append(rejected, name)
+			mu.Unlock()
+		}, priority, false)
+	}
+
+	task("bulk1", PriorityLow)
+	task("bulk2", PriorityLow)
+	if task("bulk3", PriorityLow) {
+		t.Fatal("queue is full, expect bulk3 rejected")
+	}
+	//队列已满，高优先级的请求挤掉最晚入队的低优先级请求
+	if !task("health", PriorityHigh) {
+		t.Fatal("expect high priority task accepted")
+	}
+	close(gate)
+	p.stop()
+
+	if len(rejected) != 1 || rejected[0] != "bulk2" {
+		t.Fatalf("expect bulk2 evicted, got %v", rejected)
+	}
+	if len(order) != 2 || order[0] != "health" || order[1] != "bulk1" {
+		t.Fatalf("expect health to run first, got %v", order)
+	}
+}
+
+func TestWorkerPoolAbort(t *testing.T) {
+	p := newWorkerPool(1, 2)
+
+	gate := make(chan struct{})
+	defer close(gate)
+	started := make(chan struct{})
+	p.submit(func() { close(started); <-gate }, nil, PriorityNormal, false)
+	<-started
+
+	var rejected int
+	for i := 0; i < 2; i++ {
+		p.submit(func() { t.Error("queued task should not run after abort") }, func() { rejected++ }, PriorityNormal, false)
+	}
+	//正在执行的任务没有返回，abort也不等待
+	p.abort()
+	if rejected != 2 {
+		t.Fatalf("expect 2 queued tasks rejected, got %d", rejected)
+	}
+	if p.submit(func() {}, nil, PriorityHigh, false) {
+		t.Fatal("expect submit after abort to fail")
+	}
+}
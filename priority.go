@@ -0,0 +1,60 @@
+package goRPC
+
+import (
+	"context"
+	"strconv"
+)
+
+// Priority 请求优先级，worker pool已满时优先处理数值大的请求
+type Priority int
+
+const (
+	PriorityLow    Priority = -1 //批量任务
+	PriorityNormal Priority = 0
+	PriorityHigh   Priority = 1 //健康检查、控制面调用
+)
+
+// PriorityMetadataKey 客户端通过该元数据设置请求的优先级
+const PriorityMetadataKey = "gorpc-priority"
+
+// WithPriority 客户端使用，返回设置了请求优先级的ctx，会保留ctx中已有的元数据
+func WithPriority(ctx context.Context, p Priority) context.Context {
+	md := Metadata{}
+	if outgoing, ok := OutgoingMetadata(ctx); ok {
+		md = outgoing.Copy()
+	}
+	md.Set(PriorityMetadataKey, strconv.Itoa(int(p)))
+	return NewOutgoingContext(ctx, md)
+}
+
+// WithMethodPriority 服务端设置方法的默认优先级，客户端在元数据中设置的优先级会覆盖它
+func WithMethodPriority(method string, p Priority) RegisterOption {
+	return func(o *registerOptions) {
+		if o.priority == nil {
+			o.priority = make(map[string]Priority)
+		}
+		o.priority[method] = p
+	}
+}
+
+// requestPriority 优先使用客户端在元数据中设置的优先级，其次是方法的默认优先级
+// 客户端的优先级限制在PriorityLow到PriorityHigh之间，只影响worker pool中的顺序
+func requestPriority(req *request) Priority {
+	if v, ok := req.h.Metadata[PriorityMetadataKey]; ok {
+		if p, err := strconv.Atoi(v); err == nil {
+			switch {
+			case p < int(PriorityLow):
+				return PriorityLow
+			case p > int(PriorityHigh):
+				return PriorityHigh
+			}
+			return Priority(p)
+		}
+	}
+	return req.mtype.priority
+}
+
+// exempt 服务端设置为高优先级的方法不受全局和单个连接的并发限制，客户端设置的优先级不会改变这一点
+func (m *methodType) exempt() bool {
+	return m.priority >= PriorityHigh
+}
@@ -0,0 +1,32 @@
+package goRPC
+
+import (
+	"testing"
+
+	"github.com/wjh791072385/gorpc/codec"
+)
+
+func TestRequestPriority(t *testing.T) {
+	tests := []struct {
+		value  string
+		method Priority
+		expect Priority
+	}{
+		{"", PriorityLow, PriorityLow},
+		{"1", PriorityNormal, PriorityHigh},
+		{"-1", PriorityHigh, PriorityLow},
+		{"100", PriorityNormal, PriorityHigh}, //超出范围的优先级被限制
+		{"-100", PriorityNormal, PriorityLow},
+		{"abc", PriorityHigh, PriorityHigh},
+	}
+	for _, tt := range tests {
+		h := &codec.Header{}
+		if tt.value != "" {
+			h.Metadata = map[string]string{PriorityMetadataKey: tt.value}
+		}
+		req := &request{h: h, mtype: &methodType{priority: tt.method}}
+		if p := requestPriority(req); p != tt.expect {
+			t.Errorf("priority %q with method %d: expect %d, got %d", tt.value, tt.method, tt.expect, p)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package goRPC
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"sync"
+	"time"
+)
+
+// RateLimitKey 限流的维度
+type RateLimitKey int
+
+const (
+	RateLimitByMethod     RateLimitKey = iota //每个方法一个令牌桶
+	RateLimitByRemoteAddr                     //每个客户端IP一个令牌桶
+	RateLimitByPrincipal                      //每个认证主体一个令牌桶，主体由WithPrincipalFunc设置的函数获取
+)
+
+func (k RateLimitKey) String() string {
+	switch k {
+	case RateLimitByMethod:
+		return "method"
+	case RateLimitByRemoteAddr:
+		return "remote"
+	default:
+		return "principal"
+	}
+}
+
+// PrincipalMetadataKey 约定的认证主体元数据，客户端可以随意设置，只有网关等可信的一方写入时才能用于限流
+const PrincipalMetadataKey = "gorpc-principal"
+
+// PrincipalFunc 从请求元数据中获取认证主体，比如校验并解析token
+type PrincipalFunc func(md Metadata) string
+
+// RateLimitRule 令牌桶限流规则，Method为空表示对所有方法生效
+type RateLimitRule struct {
+	By     RateLimitKey
+	Method string  //比如 Foo.Sum
+	Rate   float64 //每秒产生的令牌数
+	Burst  int     //桶的容量
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+type bucketKey struct {
+	by     RateLimitKey
+	method string //规则的Method
+	value  string //方法名、IP或者主体
+}
+
+// maxBuckets 令牌桶数量超过该值时清理已经装满的桶，防止按IP限流时无限增长
+const maxBuckets = 4096
+
+type rateLimiter struct {
+	mu        sync.Mutex
+	rules     []RateLimitRule
+	buckets   map[bucketKey]*tokenBucket
+	principal PrincipalFunc //为nil时不接受按主体限流的规则
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{
+		buckets: make(map[bucketKey]*tokenBucket),
+	}
+}
+
+// set 添加规则，By和Method相同的规则会被替换
+func (l *rateLimiter) set(rule RateLimitRule) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.removeLocked(rule.By, rule.Method)
+	l.rules = append(l.rules, rule)
+}
+
+func (l *rateLimiter) remove(by RateLimitKey, method string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.removeLocked(by, method)
+}
+
+func (l *rateLimiter) removeLocked(by RateLimitKey, method string) {
+	rules := l.rules[:0]
+	for _, r := range l.rules {
+		if r.By != by || r.Method != method {
+			rules = append(rules, r)
+		}
+	}
+	l.rules = rules
+	for key := range l.buckets {
+		if key.by == by && key.method == method {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// allow 所有匹配的规则都有令牌时才放行并扣除令牌，否则返回需要等待的时间
+func (l *rateLimiter) allow(serviceMethod, remote string, md Metadata) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.rules) == 0 {
+		return true, 0
+	}
+
+	now := time.Now()
+	var matched []*tokenBucket
+	var wait time.Duration
+	for _, r := range l.rules {
+		if r.Method != "" && r.Method != serviceMethod {
+			continue
+		}
+		key := bucketKey{by: r.By, method: r.Method}
+		switch r.By {
+		case RateLimitByMethod:
+			key.value = serviceMethod
+		case RateLimitByRemoteAddr:
+			key.value = remoteHost(remote)
+		case RateLimitByPrincipal:
+			key.value = l.principal(md)
+		}
+		b := l.bucket(key, r, now)
+		if b.tokens < 1 {
+			//令牌不足，计算补足一个令牌需要的时间
+			if d := time.Duration(math.Ceil((1 - b.tokens) / r.Rate * float64(time.Second))); d > wait {
+				wait = d
+			}
+			continue
+		}
+		matched = append(matched, b)
+	}
+	if wait > 0 {
+		return false, wait
+	}
+	for _, b := range matched {
+		b.tokens--
+	}
+	return true, 0
+}
+
+// bucket 获取令牌桶，并按照流逝的时间补充令牌
+func (l *rateLimiter) bucket(key bucketKey, r RateLimitRule, now time.Time) *tokenBucket {
+	b, ok := l.buckets[key]
+	if !ok {
+		if len(l.buckets) >= maxBuckets {
+			l.prune(now)
+		}
+		b = &tokenBucket{tokens: float64(r.Burst), last: now}
+		l.buckets[key] = b
+		return b
+	}
+	b.tokens = math.Min(float64(r.Burst), b.tokens+now.Sub(b.last).Seconds()*r.Rate)
+	b.last = now
+	return b
+}
+
+// prune 删除已经补满的桶，它们和新建的桶没有区别
+func (l *rateLimiter) prune(now time.Time) {
+	for key, b := range l.buckets {
+		for _, r := range l.rules {
+			if r.By == key.by && r.Method == key.method && b.tokens+now.Sub(b.last).Seconds()*r.Rate >= float64(r.Burst) {
+				delete(l.buckets, key)
+				break
+			}
+		}
+	}
+}
+
+func remoteHost(remote string) string {
+	host, _, err := net.SplitHostPort(remote)
+	if err != nil {
+		return remote
+	}
+	return host
+}
+
+// SetRateLimit 运行时添加或替换限流规则，By和Method相同的规则会被替换
+// 按主体限流需要先通过WithPrincipalFunc设置获取认证主体的方法
+func (server *Server) SetRateLimit(rule RateLimitRule) error {
+	if rule.Rate <= 0 || rule.Burst <= 0 {
+		return fmt.Errorf("rpc server: invalid rate limit rate=%v burst=%d", rule.Rate, rule.Burst)
+	}
+	if rule.By == RateLimitByPrincipal && server.limiter.principal == nil {
+		return errors.New("rpc server: rate limit by principal needs WithPrincipalFunc")
+	}
+	server.limiter.set(rule)
+	return nil
+}
+
+// RemoveRateLimit 运行时删除限流规则
+func (server *Server) RemoveRateLimit(by RateLimitKey, method string) {
+	server.limiter.remove(by, method)
+}
+
+// WithPrincipalFunc 设置按主体限流时获取主体的方法，没有默认值
+// 客户端设置的元数据不可信，f应当校验凭证，或者只读取可信的一方写入的元数据
+func WithPrincipalFunc(f PrincipalFunc) ServerOption {
+	return func(s *Server) {
+		s.limiter.principal = f
+	}
+}
+
+// checkRateLimit 被限流时返回带RetryAfter的ResourceExhausted错误
+func (server *Server) checkRateLimit(req *request, remote string) error {
+	ok, wait := server.limiter.allow(req.h.ServiceMethod, remote, Metadata(req.h.Metadata))
+	if ok {
+		return nil
+	}
+	return &Error{
+		Code:       CodeResourceExhausted,
+		Message:    fmt.Sprintf("rpc server: rate limit exceeded for %s, retry after %s", req.h.ServiceMethod, wait),
+		RetryAfter: wait,
+	}
+}
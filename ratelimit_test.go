@@ -0,0 +1,92 @@
+package goRPC_test
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	goRPC "github.com/wjh791072385/gorpc"
+)
+
+func TestRateLimit(t *testing.T) {
+	//测试中直接信任客户端设置的主体
+	server := goRPC.NewServer(goRPC.WithPrincipalFunc(func(md goRPC.Metadata) string {
+		return md.Get(goRPC.PrincipalMetadataKey)
+	}))
+	_ = server.RegisterName("Version", Version(1))
+	l, _ := net.Listen("tcp", ":0")
+	go server.Accept(l)
+	defer l.Close()
+
+	client, err := goRPC.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	call := func(ctx context.Context) error {
+		var reply int
+		return client.Call(ctx, "Version.Get", 0, &reply)
+	}
+
+	_ = server.SetRateLimit(goRPC.RateLimitRule{By: goRPC.RateLimitByMethod, Method: "Version.Get", Rate: 1, Burst: 2})
+	for i := 0; i < 2; i++ {
+		if err := call(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = call(context.Background())
+	if goRPC.ErrorCode(err) != goRPC.CodeResourceExhausted || goRPC.RetryAfter(err) <= 0 {
+		t.Fatalf("expect rate limited with retry after, got %v", err)
+	}
+
+	//按主体限流，每个主体有自己的令牌桶
+	server.RemoveRateLimit(goRPC.RateLimitByMethod, "Version.Get")
+	_ = server.SetRateLimit(goRPC.RateLimitRule{By: goRPC.RateLimitByPrincipal, Rate: 1, Burst: 1})
+	alice := goRPC.NewOutgoingContext(context.Background(), goRPC.Metadata{goRPC.PrincipalMetadataKey: "alice"})
+	bob := goRPC.NewOutgoingContext(context.Background(), goRPC.Metadata{goRPC.PrincipalMetadataKey: "bob"})
+	if err := call(alice); err != nil {
+		t.Fatal(err)
+	}
+	if err := call(alice); goRPC.ErrorCode(err) != goRPC.CodeResourceExhausted {
+		t.Fatalf("expect alice rate limited, got %v", err)
+	}
+	if err := call(bob); err != nil {
+		t.Fatalf("bob should not be limited, got %v", err)
+	}
+}
+
+// 没有设置PrincipalFunc时不接受按主体限流的规则
+func TestRateLimitPrincipalRequiresFunc(t *testing.T) {
+	server := goRPC.NewServer()
+	if err := server.SetRateLimit(goRPC.RateLimitRule{By: goRPC.RateLimitByPrincipal, Rate: 1, Burst: 1}); err == nil {
+		t.Fatal("expect error without WithPrincipalFunc")
+	}
+}
+
+// 对所有方法生效的规则不限制健康检查
+func TestRateLimitHealthExempt(t *testing.T) {
+	server := goRPC.NewServer()
+	_ = server.RegisterName("Version", Version(1))
+	l, _ := net.Listen("tcp", ":0")
+	go server.Accept(l)
+	defer l.Close()
+
+	client, err := goRPC.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	_ = server.SetRateLimit(goRPC.RateLimitRule{By: goRPC.RateLimitByRemoteAddr, Rate: 0.1, Burst: 1})
+	var reply int
+	_ = client.Call(context.Background(), "Version.Get", 0, &reply)
+	if err := client.Call(context.Background(), "Version.Get", 0, &reply); goRPC.ErrorCode(err) != goRPC.CodeResourceExhausted {
+		t.Fatalf("expect Version.Get rate limited, got %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if s := checkHealth(t, client, ""); s != goRPC.HealthServing {
+			t.Fatalf("expect SERVING, got %s", s)
+		}
+	}
+}
@@ -0,0 +1,245 @@
+package goRPC
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// ConnState 可重连客户端的连接状态
+type ConnState int
+
+const (
+	StateConnecting       ConnState = iota //正在建立连接、发送Option
+	StateReady                             //连接可用
+	StateTransientFailure                  //连接失败或断开，等待退避之后重连
+	StateShutdown                          //已经调用Close
+)
+
+func (s ConnState) String() string {
+	switch s {
+	case StateConnecting:
+		return "CONNECTING"
+	case StateReady:
+		return "READY"
+	case StateTransientFailure:
+		return "TRANSIENT_FAILURE"
+	default:
+		return "SHUTDOWN"
+	}
+}
+
+// Backoff 指数退避：第n次重试等待 min(Base*Factor^n, Max)，再随机浮动±Jitter比例，避免大量客户端同时重连
+type Backoff struct {
+	Base   time.Duration
+	Max    time.Duration
+	Factor float64 //小于1时按1处理，每次都等待Base
+	Jitter float64 //0~1
+}
+
+var DefaultBackoff = Backoff{
+	Base:   100 * time.Millisecond,
+	Max:    10 * time.Second,
+	Factor: 1.6,
+	Jitter: 0.2,
+}
+
+// Duration 返回第retries次重试（从0开始）之前需要等待的时间
+func (b Backoff) Duration(retries int) time.Duration {
+	factor := math.Max(b.Factor, 1)
+	d := float64(b.Base) * math.Pow(factor, float64(retries))
+	if b.Max > 0 && d > float64(b.Max) {
+		d = float64(b.Max)
+	}
+	if b.Jitter > 0 {
+		d *= 1 + b.Jitter*(rand.Float64()*2-1)
+	}
+	return time.Duration(d)
+}
+
+// ReconnectClient 连接断开后按退避策略自动重连，重连成功后新的调用继续在新连接上发送
+// 连接断开时正在进行的调用会返回错误，不会自动重发
+type ReconnectClient struct {
+	network, address string
+	opt              *Option
+	backoff          Backoff
+	onStateChange    func(ConnState)
+
+	mu      sync.Mutex // protect following
+	client  *Client
+	state   ConnState
+	changed chan struct{} //状态变化时关闭并替换，用于等待连接可用
+
+	done chan struct{}
+}
+
+// ReconnectOption 可重连客户端的可选配置
+type ReconnectOption func(*ReconnectClient)
+
+// WithBackoff 设置重连的退避策略，默认DefaultBackoff
+func WithBackoff(b Backoff) ReconnectOption {
+	return func(rc *ReconnectClient) {
+		rc.backoff = b
+	}
+}
+
+// WithStateCallback 连接状态变化时回调，在重连的goroutine中按顺序调用，不要阻塞
+// Close之后最后回调一次SHUTDOWN，正在拨号时等拨号返回后回调
+func WithStateCallback(f func(ConnState)) ReconnectOption {
+	return func(rc *ReconnectClient) {
+		rc.onStateChange = f
+	}
+}
+
+// DialReconnect 在后台建立连接并立即返回，调用会等待连接可用
+func DialReconnect(network, address string, opt *Option, opts ...ReconnectOption) *ReconnectClient {
+	rc := &ReconnectClient{
+		network: network,
+		address: address,
+		opt:     opt,
+		backoff: DefaultBackoff,
+		state:   StateConnecting,
+		changed: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	for _, o := range opts {
+		o(rc)
+	}
+	go rc.run()
+	return rc
+}
+
+// minReadyDuration 连接保持可用超过该时间，或者收到过对端的数据，才认为重连成功并重新开始退避
+// 否则对端接受连接后立即断开时，客户端会不停地重连
+const minReadyDuration = time.Second
+
+// run 所有状态回调都在这里发出，退出时回调SHUTDOWN
+func (rc *ReconnectClient) run() {
+	defer rc.notify(StateShutdown)
+	retries := 0
+	for {
+		if !rc.setState(StateConnecting, nil) {
+			return
+		}
+		client, err := Dial(rc.network, rc.address, rc.opt)
+		if err != nil {
+			rc.opt.logger().Warn("rpc client: reconnect failed", "addr", rc.address, "retries", retries, "err", err)
+		} else {
+			readyAt := time.Now()
+			if !rc.setState(StateReady, client) {
+				_ = client.Close()
+				return
+			}
+			//等待连接断开，包括keepalive超时
+			select {
+			case <-client.done:
+			case <-rc.done:
+				return
+			}
+			if time.Since(readyAt) >= minReadyDuration || client.lastReceived().After(readyAt) {
+				retries = 0
+			}
+			rc.opt.logger().Warn("rpc client: connection lost", "addr", rc.address, "retries", retries)
+		}
+
+		//连接失败和连接断开都先退避再重连
+		if !rc.setState(StateTransientFailure, nil) {
+			return
+		}
+		select {
+		case <-time.After(rc.backoff.Duration(retries)):
+		case <-rc.done:
+			return
+		}
+		retries++
+	}
+}
+
+// setState 已经Close时返回false，只在run中调用
+func (rc *ReconnectClient) setState(state ConnState, client *Client) bool {
+	rc.mu.Lock()
+	if rc.state == StateShutdown {
+		rc.mu.Unlock()
+		return false
+	}
+	rc.state = state
+	rc.client = client
+	close(rc.changed)
+	rc.changed = make(chan struct{})
+	rc.mu.Unlock()
+
+	rc.notify(state)
+	return true
+}
+
+func (rc *ReconnectClient) notify(state ConnState) {
+	if rc.onStateChange != nil {
+		rc.onStateChange(state)
+	}
+}
+
+// State 返回当前连接状态
+func (rc *ReconnectClient) State() ConnState {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return rc.state
+}
+
+// IsAvailable 连接可用时返回true
+func (rc *ReconnectClient) IsAvailable() bool {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return rc.state == StateReady && rc.client.IsAvailable()
+}
+
+// readyClient 等待连接可用，ctx结束或已经Close时返回错误
+func (rc *ReconnectClient) readyClient(ctx context.Context) (*Client, error) {
+	for {
+		rc.mu.Lock()
+		state, client, changed := rc.state, rc.client, rc.changed
+		rc.mu.Unlock()
+		if state == StateShutdown {
+			return nil, ErrShutdown
+		}
+		if state == StateReady && client.IsAvailable() {
+			return client, nil
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Call 等待连接可用后发起调用
+func (rc *ReconnectClient) Call(ctx context.Context, serviceMethod string, args, reply interface{}) error {
+	client, err := rc.readyClient(ctx)
+	if err != nil {
+		return err
+	}
+	return client.Call(ctx, serviceMethod, args, reply)
+}
+
+// Close 停止重连并关闭当前连接，SHUTDOWN由重连的goroutine回调
+func (rc *ReconnectClient) Close() error {
+	rc.mu.Lock()
+	if rc.state == StateShutdown {
+		rc.mu.Unlock()
+		return ErrShutdown
+	}
+	rc.state = StateShutdown
+	client := rc.client
+	rc.client = nil
+	close(rc.changed)
+	rc.changed = make(chan struct{})
+	close(rc.done)
+	rc.mu.Unlock()
+
+	if client != nil {
+		return client.Close()
+	}
+	return nil
+}
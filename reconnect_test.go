@@ -0,0 +1,228 @@
+package goRPC_test
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	goRPC "github.com/wjh791072385/gorpc"
+)
+
+func TestBackoff(t *testing.T) {
+	b := goRPC.Backoff{Base: 100 * time.Millisecond, Max: time.Second, Factor: 2, Jitter: 0.2}
+	for retries, want := range []time.Duration{100, 200, 400, 800, 1000, 1000} {
+		want *= time.Millisecond
+		d := b.Duration(retries)
+		if d < want*8/10 || d > want*12/10 {
+			t.Fatalf("retries %d: expect about %s, got %s", retries, want, d)
+		}
+	}
+}
+
+// Factor小于1时每次都等待Base，不会变成0
+func TestBackoffFactorBelowOne(t *testing.T) {
+	for _, factor := range []float64{0, 0.5, 1} {
+		b := goRPC.Backoff{Base: 100 * time.Millisecond, Max: time.Second, Factor: factor}
+		for retries := 0; retries < 4; retries++ {
+			if d := b.Duration(retries); d != 100*time.Millisecond {
+				t.Fatalf("factor %v retries %d: expect 100ms, got %s", factor, retries, d)
+			}
+		}
+	}
+}
+
+// stateRecorder 记录状态变化，测试等待回调而不是sleep
+type stateRecorder struct {
+	ch chan goRPC.ConnState
+	at chan time.Time //每次进入CONNECTING的时间
+}
+
+func newStateRecorder() *stateRecorder {
+	return &stateRecorder{ch: make(chan goRPC.ConnState, 100), at: make(chan time.Time, 100)}
+}
+
+func (r *stateRecorder) record(s goRPC.ConnState) {
+	if s == goRPC.StateConnecting {
+		r.at <- time.Now()
+	}
+	r.ch <- s
+}
+
+// wait 依次等待states中的状态出现，中间可以有其他状态
+func (r *stateRecorder) wait(t *testing.T, states ...goRPC.ConnState) {
+	t.Helper()
+	timeout := time.After(2 * time.Second)
+	for _, want := range states {
+		for got := goRPC.ConnState(-1); got != want; {
+			select {
+			case got = <-r.ch:
+			case <-timeout:
+				t.Fatalf("timeout waiting for state %s", want)
+			}
+		}
+	}
+}
+
+func TestReconnectClient(t *testing.T) {
+	//服务端关闭空闲连接，模拟连接断开
+	server := goRPC.NewServer(goRPC.WithIdleTimeout(100 * time.Millisecond))
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	go server.Accept(l)
+	defer l.Close()
+
+	r := newStateRecorder()
+	rc := goRPC.DialReconnect("tcp", l.Addr().String(), nil,
+		goRPC.WithBackoff(goRPC.Backoff{Base: 10 * time.Millisecond, Max: 50 * time.Millisecond, Factor: 2}),
+		goRPC.WithStateCallback(r.record))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	var reply goRPC.HealthCheckResponse
+	if err := rc.Call(ctx, "Health.Check", goRPC.HealthCheckRequest{}, &reply); err != nil {
+		t.Fatal(err)
+	}
+
+	r.wait(t, goRPC.StateReady, goRPC.StateTransientFailure, goRPC.StateConnecting, goRPC.StateReady)
+	if err := rc.Call(ctx, "Health.Check", goRPC.HealthCheckRequest{}, &reply); err != nil {
+		t.Fatalf("call after reconnect: %v", err)
+	}
+	_ = rc.Close()
+	if err := rc.Call(ctx, "Health.Check", goRPC.HealthCheckRequest{}, &reply); err != goRPC.ErrShutdown {
+		t.Fatalf("expect ErrShutdown after Close, got %v", err)
+	}
+	r.wait(t, goRPC.StateShutdown)
+}
+
+// 对端接受连接后立即断开时，退避时间继续增长，不会立即重连
+func TestReconnectClientFlapping(t *testing.T) {
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			var opt goRPC.Option
+			_ = json.NewDecoder(conn).Decode(&opt)
+			_ = conn.Close()
+		}
+	}()
+
+	base := 20 * time.Millisecond
+	r := newStateRecorder()
+	rc := goRPC.DialReconnect("tcp", l.Addr().String(), nil,
+		goRPC.WithBackoff(goRPC.Backoff{Base: base, Max: time.Second, Factor: 2}),
+		goRPC.WithStateCallback(r.record))
+	defer rc.Close()
+
+	prev := <-r.at
+	for i := 0; i < 4; i++ {
+		var at time.Time
+		select {
+		case at = <-r.at:
+		case <-time.After(2 * time.Second):
+			t.Fatal("timeout waiting for reconnect")
+		}
+		if want := base << uint(i); at.Sub(prev) < want {
+			t.Fatalf("reconnect %d after %s, expect backoff at least %s", i+1, at.Sub(prev), want)
+		}
+		prev = at
+	}
+}
+
+func TestReconnectClientWaitReady(t *testing.T) {
+	//先占一个端口再关闭，保证连接失败
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	addr := l.Addr().String()
+	_ = l.Close()
+
+	rc := goRPC.DialReconnect("tcp", addr, nil,
+		goRPC.WithBackoff(goRPC.Backoff{Base: 10 * time.Millisecond, Max: 20 * time.Millisecond, Factor: 2}))
+	defer rc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	var reply goRPC.HealthCheckResponse
+	if err := rc.Call(ctx, "Health.Check", goRPC.HealthCheckRequest{}, &reply); err != context.DeadlineExceeded {
+		t.Fatalf("expect deadline exceeded, got %v", err)
+	}
+
+	//服务端启动后自动连上
+	server := goRPC.NewServer()
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Skip("port reused:", err)
+	}
+	go server.Accept(l)
+	defer l.Close()
+
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := rc.Call(ctx, "Health.Check", goRPC.HealthCheckRequest{}, &reply); err != nil {
+		t.Fatal(err)
+	}
+	if rc.State() != goRPC.StateReady {
+		t.Fatalf("expect READY, got %s", rc.State())
+	}
+}
+
+// 状态回调在重连的goroutine中按顺序调用，SHUTDOWN是最后一次回调
+func TestReconnectClientCallbackOrder(t *testing.T) {
+	//接受连接后立即断开，不停地重连
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			_ = conn.Close()
+		}
+	}()
+
+	var mu sync.Mutex
+	var states []goRPC.ConnState
+	var running int32
+	shutdown := make(chan struct{})
+	rc := goRPC.DialReconnect("tcp", l.Addr().String(), nil,
+		goRPC.WithBackoff(goRPC.Backoff{Base: time.Millisecond, Max: time.Millisecond}),
+		goRPC.WithStateCallback(func(s goRPC.ConnState) {
+			if atomic.AddInt32(&running, 1) != 1 {
+				t.Error("state callbacks run concurrently")
+			}
+			time.Sleep(time.Millisecond)
+			mu.Lock()
+			states = append(states, s)
+			mu.Unlock()
+			atomic.AddInt32(&running, -1)
+			if s == goRPC.StateShutdown {
+				close(shutdown)
+			}
+		}))
+
+	time.Sleep(30 * time.Millisecond)
+	_ = rc.Close()
+	select {
+	case <-shutdown:
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for SHUTDOWN callback")
+	}
+	time.Sleep(30 * time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if n := len(states); n < 2 || states[n-1] != goRPC.StateShutdown {
+		t.Fatalf("expect SHUTDOWN as the last callback, got %v", states)
+	}
+	for _, s := range states[:len(states)-1] {
+		if s == goRPC.StateShutdown {
+			t.Fatalf("expect a single SHUTDOWN, got %v", states)
+		}
+	}
+}
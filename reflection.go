@@ -0,0 +1,109 @@
+package goRPC
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+)
+
+// ReflectionServiceName 每个Server自动注册的反射服务，客户端可以通过它查询服务列表和方法的参数结构
+// 比如调用 goRPC.Reflection.ListServices、goRPC.Reflection.DescribeService
+const ReflectionServiceName = "goRPC.Reflection"
+
+// TypeSchema 参数类型的描述，可以被通用工具和动态客户端解析
+type TypeSchema struct {
+	Name   string        //类型名，比如 main.Args、[]int
+	Kind   string        //reflect.Kind，比如 struct、int、slice
+	Elem   *TypeSchema   //ptr、slice、array、map的元素类型
+	Key    *TypeSchema   //map的key类型
+	Len    int           //array的长度
+	Fields []FieldSchema //struct的导出字段
+	Ref    bool          //递归类型再次出现时只记录名字，结构参考第一次出现的位置
+}
+
+type FieldSchema struct {
+	Name string
+	Type *TypeSchema
+}
+
+type MethodDescriptor struct {
+	Name      string
+	ArgType   *TypeSchema
+	ReplyType *TypeSchema
+}
+
+type ServiceDescriptor struct {
+	Name    string
+	Methods []MethodDescriptor //按方法名排序
+}
+
+// Reflection 内置的反射服务
+type Reflection struct {
+	server *Server
+}
+
+// ListServices 返回所有已注册的服务名，按名字排序
+func (r *Reflection) ListServices(args struct{}, reply *[]string) error {
+	names := make([]string, 0)
+	r.server.serviceMap.Range(func(key, value interface{}) bool {
+		names = append(names, key.(string))
+		return true
+	})
+	sort.Strings(names)
+	*reply = names
+	return nil
+}
+
+// DescribeService 返回服务下所有方法及参数的结构
+func (r *Reflection) DescribeService(name string, reply *ServiceDescriptor) error {
+	svci, ok := r.server.serviceMap.Load(name)
+	if !ok {
+		return errors.New("rpc server: can't find service " + name)
+	}
+	svc := svci.(*service)
+
+	desc := ServiceDescriptor{Name: svc.name}
+	for mName, mt := range svc.method {
+		desc.Methods = append(desc.Methods, MethodDescriptor{
+			Name:      mName,
+			ArgType:   describeType(mt.ArgType, make(map[reflect.Type]bool)),
+			ReplyType: describeType(mt.ReplyType, make(map[reflect.Type]bool)),
+		})
+	}
+	sort.Slice(desc.Methods, func(i, j int) bool {
+		return desc.Methods[i].Name < desc.Methods[j].Name
+	})
+	*reply = desc
+	return nil
+}
+
+// describeType 递归地描述类型，seen记录当前路径上出现过的struct，防止递归类型死循环
+func describeType(t reflect.Type, seen map[reflect.Type]bool) *TypeSchema {
+	ts := &TypeSchema{Name: t.String(), Kind: t.Kind().String()}
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice:
+		ts.Elem = describeType(t.Elem(), seen)
+	case reflect.Array:
+		ts.Len = t.Len()
+		ts.Elem = describeType(t.Elem(), seen)
+	case reflect.Map:
+		ts.Key = describeType(t.Key(), seen)
+		ts.Elem = describeType(t.Elem(), seen)
+	case reflect.Struct:
+		if seen[t] {
+			ts.Ref = true
+			return ts
+		}
+		seen[t] = true
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.PkgPath != "" {
+				//未导出字段不会被编码，跳过
+				continue
+			}
+			ts.Fields = append(ts.Fields, FieldSchema{Name: f.Name, Type: describeType(f.Type, seen)})
+		}
+		delete(seen, t)
+	}
+	return ts
+}
@@ -0,0 +1,63 @@
+package goRPC_test
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	goRPC "github.com/wjh791072385/gorpc"
+)
+
+type Tree struct {
+	Value    int
+	Children []*Tree
+	secret   int
+}
+
+type Walker int
+
+func (w Walker) Walk(args Tree, reply *[]int) error {
+	return nil
+}
+
+func TestReflection(t *testing.T) {
+	server := goRPC.NewServer()
+	var w Walker
+	_ = server.Register(&w)
+	l, _ := net.Listen("tcp", ":0")
+	go server.Accept(l)
+
+	client, err := goRPC.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	var services []string
+	if err := client.Call(context.Background(), goRPC.ReflectionServiceName+".ListServices", struct{}{}, &services); err != nil {
+		t.Fatal(err)
+	}
+	if len(services) != 3 || services[0] != goRPC.HealthServiceName || services[1] != "Walker" || services[2] != goRPC.ReflectionServiceName {
+		t.Fatalf("unexpected services %v", services)
+	}
+
+	var desc goRPC.ServiceDescriptor
+	if err := client.Call(context.Background(), goRPC.ReflectionServiceName+".DescribeService", "Walker", &desc); err != nil {
+		t.Fatal(err)
+	}
+	if len(desc.Methods) != 1 || desc.Methods[0].Name != "Walk" {
+		t.Fatalf("unexpected methods %+v", desc.Methods)
+	}
+	arg := desc.Methods[0].ArgType
+	if arg.Kind != "struct" || len(arg.Fields) != 2 || arg.Fields[0].Name != "Value" {
+		t.Fatalf("unexpected arg schema %+v", arg)
+	}
+	//Children -> slice -> ptr -> Tree(递归引用)
+	children := arg.Fields[1].Type
+	if children.Kind != "slice" || children.Elem.Kind != "ptr" || !children.Elem.Elem.Ref {
+		t.Fatalf("unexpected recursive schema %+v", children)
+	}
+	if reply := desc.Methods[0].ReplyType; reply.Kind != "ptr" || reply.Elem.Kind != "slice" {
+		t.Fatalf("unexpected reply schema %+v", reply)
+	}
+}
@@ -4,10 +4,12 @@ import (
 	"bytes"
 	"encoding/json"
 	"io/ioutil"
-	"log"
 	"net/http"
+	"sort"
 	"sync"
 	"time"
+
+	goRPC "github.com/wjh791072385/gorpc"
 )
 
 // Registry 简单实现注册中心
@@ -17,11 +19,23 @@ type Registry struct {
 	timeout time.Duration
 	mu      sync.Mutex
 	servers map[string]*ServerItem
+	logger  goRPC.Logger
+}
+
+// Option 注册中心的可选配置
+type Option func(*Registry)
+
+// WithLogger 设置注册中心的日志，默认使用goRPC.DefaultLogger
+func WithLogger(logger goRPC.Logger) Option {
+	return func(r *Registry) {
+		r.logger = logger
+	}
 }
 
 type ServerItem struct {
-	Addr  string
-	start time.Time
+	Addr   string
+	Weight int //负载均衡权重，0表示默认权重
+	start  time.Time
 }
 
 const (
@@ -29,46 +43,59 @@ const (
 	defaultTimeout = time.Second * 5
 )
 
-func NewRegistry(timeout time.Duration) *Registry {
-	return &Registry{
+// WeightedHeader GET请求带上该请求头时返回带权重的ServerItem列表，否则只返回地址列表
+const WeightedHeader = "X-Gorpc-Weighted"
+
+func NewRegistry(timeout time.Duration, opts ...Option) *Registry {
+	r := &Registry{
 		timeout: timeout,
 		servers: make(map[string]*ServerItem), //注意map必须初始化才能使用
+		logger:  goRPC.DefaultLogger,
 	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
 }
 
 var DefaultRegistry = NewRegistry(defaultTimeout)
 
-// 注册服务
-func (r *Registry) putServer(addrs []string) {
+// 注册服务，心跳中的权重会覆盖之前的权重
+func (r *Registry) putServer(items []ServerItem) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	for _, addr := range addrs {
-		s, ok := r.servers[addr]
+	for _, item := range items {
+		s, ok := r.servers[item.Addr]
 		if ok {
 			s.start = time.Now()
+			s.Weight = item.Weight
 		} else {
-			r.servers[addr] = &ServerItem{
-				Addr:  addr,
-				start: time.Now(),
+			r.servers[item.Addr] = &ServerItem{
+				Addr:   item.Addr,
+				Weight: item.Weight,
+				start:  time.Now(),
 			}
 		}
 	}
 }
 
-func (r *Registry) aliveServers() []string {
+func (r *Registry) aliveServers() []ServerItem {
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	var alive []string
+	var alive []ServerItem
 
 	for addr, s := range r.servers {
 		if r.timeout == 0 || s.start.Add(r.timeout).After(time.Now()) {
 			//如果timeout = 0表示不限制超时，或者还没超时的话，则加入alive
-			alive = append(alive, addr)
+			alive = append(alive, *s)
 		} else {
+			r.logger.Info("rpc registry: remove dead server", "addr", addr)
 			delete(r.servers, addr)
 		}
 	}
+	//按地址排序，保证客户端每次拿到的顺序一致
+	sort.Slice(alive, func(i, j int) bool { return alive[i].Addr < alive[j].Addr })
 	return alive
 }
 
@@ -77,8 +104,19 @@ func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	//log.Printf("%s %s request\n", req.URL, req.Method)
 	switch req.Method {
 	case "GET":
-		//get方法返回所有可用服务器
-		js, err := json.Marshal(r.aliveServers())
+		//get方法返回所有可用服务器，旧版本的客户端只接收地址列表
+		var v interface{}
+		alive := r.aliveServers()
+		if req.Header.Get(WeightedHeader) != "" {
+			v = alive
+		} else {
+			addrs := make([]string, len(alive))
+			for i, s := range alive {
+				addrs[i] = s.Addr
+			}
+			v = addrs
+		}
+		js, err := json.Marshal(v)
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			return
@@ -88,12 +126,21 @@ func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		//设置或更新服务
 		body, err := ioutil.ReadAll(req.Body)
 		if err != nil || len(body) == 0 {
+			r.logger.Warn("rpc registry: read heartbeat error", "remote", req.RemoteAddr, "err", err)
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
-		s := make([]string, 0)
-		json.Unmarshal(body, &s)
-		r.putServer(s)
+		//兼容只发送地址列表的心跳
+		items := make([]ServerItem, 0)
+		if err := json.Unmarshal(body, &items); err != nil {
+			items = items[:0] //解码失败时可能已经填入了空的元素
+			addrs := make([]string, 0)
+			json.Unmarshal(body, &addrs)
+			for _, addr := range addrs {
+				items = append(items, ServerItem{Addr: addr})
+			}
+		}
+		r.putServer(items)
 	default:
 		w.WriteHeader(http.StatusMethodNotAllowed)
 	}
@@ -101,7 +148,7 @@ func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 
 func (r *Registry) HandleHTTP(registryPath string) {
 	http.Handle(registryPath, r)
-	log.Println("rpc registry path:", registryPath)
+	r.logger.Info("rpc registry: serving", "path", registryPath)
 }
 
 // HandleHTTP 对外暴露，使用默认路径，默认注册中心
@@ -109,31 +156,63 @@ func HandleHTTP() {
 	DefaultRegistry.HandleHTTP(defaultPath)
 }
 
+// HeartbeatOption 心跳的可选配置
+type HeartbeatOption func(*heartbeat)
+
+type heartbeat struct {
+	item   ServerItem
+	logger goRPC.Logger
+}
+
+// WithWeight 随心跳发布服务实例的权重，客户端按权重做加权轮询
+func WithWeight(weight int) HeartbeatOption {
+	return func(h *heartbeat) {
+		h.item.Weight = weight
+	}
+}
+
+// WithHeartbeatLogger 设置心跳的日志，默认使用goRPC.DefaultLogger
+func WithHeartbeatLogger(logger goRPC.Logger) HeartbeatOption {
+	return func(h *heartbeat) {
+		h.logger = logger
+	}
+}
+
 // Heartbeat 心跳检测
-func Heartbeat(registry, addr string, duration time.Duration) {
+func Heartbeat(registry, addr string, duration time.Duration, opts ...HeartbeatOption) {
 	if duration == 0 {
 		//确保足够时间
 		duration = defaultTimeout - time.Duration(1)*time.Second
 	}
+	h := &heartbeat{item: ServerItem{Addr: addr}, logger: goRPC.DefaultLogger}
+	for _, opt := range opts {
+		opt(h)
+	}
 	var err error
-	err = sendHeartbeat(registry, addr)
+	err = sendHeartbeat(registry, h.item, h.logger)
 	go func() {
 		//间隔duration，重复发送
 		t := time.NewTicker(duration)
 		for err == nil {
 			<-t.C
-			err = sendHeartbeat(registry, addr)
+			err = sendHeartbeat(registry, h.item, h.logger)
 		}
 	}()
 }
 
-func sendHeartbeat(registry, addr string) error {
+func sendHeartbeat(registry string, item ServerItem, logger goRPC.Logger) error {
 	//log.Println(addr, "send heart beat to registry ", registry)
 
 	httpClient := &http.Client{}
-
-	//将addr封装成[]string类型发送过去。如果是发送string,那么注册中心接收端应该做出对应修改
-	data, _ := json.Marshal([]string{addr})
+	addr := item.Addr
+
+	//没有权重时发送[]string，兼容旧版本的注册中心
+	var data []byte
+	if item.Weight > 0 {
+		data, _ = json.Marshal([]ServerItem{item})
+	} else {
+		data, _ = json.Marshal([]string{addr})
+	}
 	reader := bytes.NewReader(data)
 	req, _ := http.NewRequest("POST", registry, reader)
 	//req.Header.Set("X-gorpc-server", addr)
@@ -142,8 +221,9 @@ func sendHeartbeat(registry, addr string) error {
 	//发送json数据过去
 	resp, err := httpClient.Do(req)
 	if err != nil {
-		log.Println("rpc server: status: ", resp.StatusCode, "heart beat err:", err)
+		logger.Error("rpc server: heart beat error", "registry", registry, "addr", addr, "err", err)
 		return err
 	}
+	_ = resp.Body.Close()
 	return nil
 }
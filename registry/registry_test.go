@@ -1,10 +1,19 @@
 package registry_test
 
 import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"log"
 	"net"
 	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
+	goRPC "github.com/wjh791072385/gorpc"
 	"github.com/wjh791072385/gorpc/registry"
 )
 
@@ -14,3 +23,58 @@ func TestStartRegistry(t *testing.T) {
 	registry.HandleHTTP() //注册路由，默认路径是/gorpc/registry
 	_ = http.Serve(l, nil)
 }
+
+func TestHeartbeatLogger(t *testing.T) {
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	addr := l.Addr().String()
+	_ = l.Close() //注册中心不可用
+
+	var buf bytes.Buffer
+	logger := goRPC.NewStdLogger(log.New(&buf, "", 0), goRPC.LevelInfo)
+	registry.Heartbeat("http://"+addr+"/gorpc/registry", "127.0.0.1:1", time.Hour, registry.WithHeartbeatLogger(logger))
+	if !strings.Contains(buf.String(), "ERROR rpc server: heart beat error") {
+		t.Fatalf("expect heartbeat error logged by custom logger, got %q", buf.String())
+	}
+}
+
+func getServers(t *testing.T, url string, weighted bool, v interface{}) {
+	t.Helper()
+	req, _ := http.NewRequest("GET", url, nil)
+	if weighted {
+		req.Header.Set(registry.WeightedHeader, "1")
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, _ := ioutil.ReadAll(resp.Body)
+	if err := json.Unmarshal(data, v); err != nil {
+		t.Fatalf("decode %q: %v", data, err)
+	}
+}
+
+// 带权重的心跳和只发送地址的旧版本心跳都可以注册，GET按请求头返回两种格式
+func TestRegistryWeighted(t *testing.T) {
+	ts := httptest.NewServer(registry.NewRegistry(0))
+	defer ts.Close()
+
+	registry.Heartbeat(ts.URL, "127.0.0.1:1", time.Hour, registry.WithWeight(3))
+	registry.Heartbeat(ts.URL, "127.0.0.1:2", time.Hour) //没有权重时发送地址列表
+
+	tests := []struct {
+		name     string
+		weighted bool
+		got      interface{}
+		expect   interface{}
+	}{
+		{"weighted", true, &[]registry.ServerItem{}, &[]registry.ServerItem{{Addr: "127.0.0.1:1", Weight: 3}, {Addr: "127.0.0.1:2"}}},
+		{"addresses only", false, &[]string{}, &[]string{"127.0.0.1:1", "127.0.0.1:2"}},
+	}
+	for _, tt := range tests {
+		getServers(t, ts.URL, tt.weighted, tt.got)
+		if !reflect.DeepEqual(tt.got, tt.expect) {
+			t.Errorf("%s: expect %v, got %v", tt.name, tt.expect, tt.got)
+		}
+	}
+}
@@ -1,16 +1,18 @@
 package goRPC
 
 import (
+	"bufio"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"log"
 	"net"
 	"net/http"
 	"reflect"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/wjh791072385/gorpc/codec"
@@ -31,6 +33,12 @@ type Option struct {
 	CodecType      codec.Type
 	ConnectTimeout time.Duration //规定0表示不限制超时时间
 	HandleTimeout  time.Duration
+
+	Tracer *Tracer `json:"-"` //客户端追踪，不发送给服务端
+	Logger Logger  `json:"-"` //客户端日志，为nil时使用DefaultLogger
+
+	KeepaliveInterval time.Duration `json:"-"` //超过该时间没有收到数据时发送ping，0表示不开启
+	KeepaliveTimeout  time.Duration `json:"-"` //发送ping之后超过该时间没有收到数据，终止所有请求，0时等于KeepaliveInterval
 }
 
 var DefaultOption = &Option{
@@ -42,19 +50,118 @@ var DefaultOption = &Option{
 // Server 服务端实现
 type Server struct {
 	serviceMap sync.Map
+	mu         sync.Mutex //保证Replace和Unregister的原子性，读serviceMap不需要加锁
+	tracer     *Tracer
+	logger     Logger
+	health     *Health
+
+	reqSem          semaphore //全局并发限制
+	maxConnRequests int       //单个连接的并发限制
+	pool            *workerPool
+	backpressure    bool //超过限制时暂停读取请求，而不是返回ResourceExhausted
+	limiter         *rateLimiter
+
+	maxConns         int
+	maxConnsPerIP    int
+	handshakeTimeout time.Duration
+	idleTimeout      time.Duration
+	readTimeout      time.Duration
+	writeTimeout     time.Duration
+
+	keepaliveInterval time.Duration
+	keepaliveTimeout  time.Duration
+
+	trackMu    sync.Mutex // protect following
+	listeners  map[net.Listener]struct{}
+	conns      map[io.Closer]struct{}
+	connsPerIP map[string]int
+	inShutdown int32 //Shutdown之后置为1
+	inFlight   int64 //正在处理的请求数
+}
+
+// ServerOption 服务端可选配置
+type ServerOption func(*Server)
+
+// WithTracer 开启服务端追踪
+func WithTracer(tracer *Tracer) ServerOption {
+	return func(s *Server) {
+		s.tracer = tracer
+	}
 }
 
-func NewServer() *Server {
-	return &Server{}
+// WithLogger 设置服务端日志，默认使用DefaultLogger
+func WithLogger(logger Logger) ServerOption {
+	return func(s *Server) {
+		s.logger = logger
+	}
+}
+
+// WithMaxConcurrentRequests 所有连接同时处理的请求数上限
+func WithMaxConcurrentRequests(n int) ServerOption {
+	return func(s *Server) {
+		s.reqSem = newSemaphore(n)
+	}
+}
+
+// WithMaxConnRequests 单个连接同时处理的请求数上限，防止一个客户端占满服务端
+func WithMaxConnRequests(n int) ServerOption {
+	return func(s *Server) {
+		s.maxConnRequests = n
+	}
+}
+
+// WithWorkerPool 使用固定数量的worker处理请求，请求先进入长度为queueSize的队列
+// 不设置时每个请求一个goroutine
+func WithWorkerPool(workers, queueSize int) ServerOption {
+	return func(s *Server) {
+		s.pool = newWorkerPool(workers, queueSize)
+	}
+}
+
+// WithBackpressure 达到并发限制或队列已满时，暂停读取该连接的后续请求，而不是返回ResourceExhausted错误
+// 单个连接最多maxWaitingRequests个请求等待全局、方法并发限制或者worker pool队列，超过时暂停读取该连接
+func WithBackpressure() ServerOption {
+	return func(s *Server) {
+		s.backpressure = true
+	}
+}
+
+func NewServer(opts ...ServerOption) *Server {
+	s := &Server{
+		logger:     DefaultLogger,
+		listeners:  make(map[net.Listener]struct{}),
+		conns:      make(map[io.Closer]struct{}),
+		connsPerIP: make(map[string]int),
+		limiter:    newRateLimiter(),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	//自动注册反射服务和健康检查服务，属于控制面调用，优先处理
+	s.health = newHealth(s)
+	_ = s.RegisterName(ReflectionServiceName, &Reflection{server: s},
+		WithMethodPriority("ListServices", PriorityHigh), WithMethodPriority("DescribeService", PriorityHigh))
+	_ = s.RegisterName(HealthServiceName, s.health, WithMethodPriority("Check", PriorityHigh))
+	return s
 }
 
 var DefaultServer = NewServer()
 
 func (server *Server) Accept(lis net.Listener) {
+	if !server.trackListener(lis, true) {
+		_ = lis.Close()
+		return
+	}
+	defer server.trackListener(lis, false)
+
 	for {
 		conn, err := lis.Accept()
 		if err != nil {
-			log.Println("rpc server: accept error")
+			if errors.Is(err, net.ErrClosed) {
+				server.logger.Debug("rpc server: listener closed", "addr", lis.Addr())
+			} else {
+				server.logger.Error("rpc server: accept error", "err", err)
+			}
 			return
 		}
 
@@ -84,7 +191,7 @@ func (server *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 
 	conn, _, err := w.(http.Hijacker).Hijack()
 	if err != nil {
-		log.Print("rpc hijacking ", req.RemoteAddr, ": ", err.Error())
+		server.logger.Error("rpc server: hijacking error", "remote", req.RemoteAddr, "err", err)
 		return
 	}
 
@@ -108,70 +215,145 @@ func (server *Server) ServeConn(conn io.ReadWriteCloser) {
 	// 首先使用 json.NewDecoder 反序列化得到 Option 实例，检查 MagicNumber 和 CodeType 的值是否正确。
 	//然后根据 CodeType 得到对应的消息编解码器，接下来的处理交给 serverCodec
 
+	sc := newServerConn(conn)
+	host := remoteHost(sc.remote)
+	if err := server.trackConn(conn, host, true); err != nil {
+		if err == errTooManyConns {
+			server.logger.Warn("rpc server: reject connection", "remote", sc.remote, "err", err)
+		}
+		_ = conn.Close()
+		return
+	}
 	defer func() {
+		server.trackConn(conn, host, false)
 		conn.Close()
 	}()
 
-	// 解码到Option对象中
+	// 解码到Option对象中，客户端必须在handshakeTimeout内发送Option
 	var opt Option
-	if err := json.NewDecoder(conn).Decode(&opt); err != nil {
-		log.Println("rpc server : option decode error")
+	sc.setReadDeadline(server.handshakeTimeout)
+	dec := json.NewDecoder(conn)
+	if err := dec.Decode(&opt); err != nil {
+		server.logger.Warn("rpc server: option decode error", "err", err)
 		return
 	}
 
 	if opt.MagicNumber != DefaultMagicNumber {
-		log.Println("rpc server: invalid MagicNumber")
+		server.logger.Warn("rpc server: invalid magic number", "magic", opt.MagicNumber)
 		return
 	}
 
 	f := codec.NewCodeFuncMap[opt.CodecType]
 	if f == nil {
-		log.Println("rpc server : invalid CodeType")
+		server.logger.Warn("rpc server: invalid codec type", "codec", opt.CodecType)
 		return
 	}
 
 	//这里如果opt.CodeType = "application/gob"，那么f(conn)其实返回的是一个实现Codec接口的GobCodec实例
-	server.serveCodec(f(conn), &opt)
+	//json解码时可能已经多读了后面的header和body，需要把缓冲中剩余的数据交还给codec
+	//json.Encoder会在Option后面追加一个换行符，需要跳过
+	r := bufio.NewReader(io.MultiReader(dec.Buffered(), conn))
+	if b, err := r.Peek(1); err == nil && b[0] == '\n' {
+		_, _ = r.Discard(1)
+	}
+	sc.clearReadDeadline()
+	cc := f(&deadlineConn{ReadWriteCloser: conn, r: r, conn: sc.conn, sc: sc, writeTimeout: server.writeTimeout})
+	server.serveCodec(cc, &opt, sc)
 }
 
-func (server *Server) Register(rcvr interface{}) error {
-	s := newService(rcvr)
+// Register 注册服务，类型未导出、没有符合条件的方法时返回错误
+func (server *Server) Register(rcvr interface{}, opts ...RegisterOption) error {
+	s, err := newService(rcvr, opts...)
+	if err != nil {
+		return err
+	}
 	//不存在则插入
 	if _, load := server.serviceMap.LoadOrStore(s.name, s); load {
 		return errors.New("rpc: service already defined: " + s.name)
 	}
+	server.health.serviceChanged()
+	for name := range s.method {
+		server.logger.Debug("rpc server: register", "method", s.name+"."+name)
+	}
+	for _, err := range s.skipped {
+		server.logger.Debug("rpc server: skip method", "service", s.name, "reason", err)
+	}
 	return nil
 }
 
 // Register 对外暴露
-func Register(rcvr interface{}) error {
-	return DefaultServer.Register(rcvr)
+func Register(rcvr interface{}, opts ...RegisterOption) error {
+	return DefaultServer.Register(rcvr, opts...)
+}
+
+// RegisterName 以指定的服务名注册，比如同名类型来自不同的包，或者需要固定的对外名字
+func (server *Server) RegisterName(name string, rcvr interface{}, opts ...RegisterOption) error {
+	if name == "" {
+		return errors.New("rpc server: service name is empty")
+	}
+	return server.Register(rcvr, append(opts, withServiceName(name))...)
+}
+
+// RegisterName 对外暴露
+func RegisterName(name string, rcvr interface{}, opts ...RegisterOption) error {
+	return DefaultServer.RegisterName(name, rcvr, opts...)
+}
+
+// Unregister 移除服务，正在处理的请求不受影响，之后的请求会返回找不到服务
+func (server *Server) Unregister(name string) error {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if _, ok := server.serviceMap.LoadAndDelete(name); !ok {
+		return errors.New("rpc server: can't find service " + name)
+	}
+	server.health.serviceChanged()
+	server.logger.Info("rpc server: unregister", "service", name)
+	return nil
+}
+
+// Replace 原子地将服务替换为新的rcvr，不需要重启监听
+// 已经找到旧服务的请求会在旧的rcvr上执行完，之后的请求都交给新的rcvr
+func (server *Server) Replace(name string, rcvr interface{}, opts ...RegisterOption) error {
+	s, err := newService(rcvr, append(opts, withServiceName(name))...)
+	if err != nil {
+		return err
+	}
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if _, ok := server.serviceMap.Load(name); !ok {
+		return errors.New("rpc server: can't find service " + name)
+	}
+	server.serviceMap.Store(name, s)
+	server.health.serviceChanged()
+	server.logger.Info("rpc server: replace", "service", name, "methods", len(s.method))
+	return nil
 }
 
 func (server *Server) findService(serviceMethod string) (sv *service, mt *methodType, err error) {
 	//服务名和方法名是按.分割的  比如：algorithm.Sum
 	dot := strings.LastIndex(serviceMethod, ".")
 	if dot < 0 {
-		err = errors.New("rpc server: service/method request ill-formed: " + serviceMethod)
+		err = newError(CodeNotFound, "rpc server: service/method request ill-formed: "+serviceMethod)
 		return
 	}
 
 	sName, mName := serviceMethod[:dot], serviceMethod[dot+1:]
 	svci, ok := server.serviceMap.Load(sName)
 	if !ok {
-		err = errors.New("rpc server: can't find service " + sName)
+		err = newError(CodeNotFound, "rpc server: can't find service "+sName)
 		return
 	}
 
 	sv, ok = svci.(*service) //接口断言
 	if !ok {
-		err = errors.New("rpc server: can't find service " + sName)
+		err = newError(CodeNotFound, "rpc server: can't find service "+sName)
 		return
 	}
 
 	mt = sv.method[mName]
 	if mt == nil {
-		err = errors.New("rpc server: can't find method " + mName)
+		err = newError(CodeNotFound, "rpc server: can't find method "+mName)
 	}
 	return
 }
@@ -183,61 +365,205 @@ var invalidRequest = struct{}{}
 //读取请求 readRequest
 //处理请求 handleRequest
 //回复请求 sendResponse
-func (server *Server) serveCodec(cc codec.Codec, opt *Option) {
-	sending := new(sync.Mutex) //确保发送一个完整的响应
-	wg := new(sync.WaitGroup)  //确保所有请求被处理
+func (server *Server) serveCodec(cc codec.Codec, opt *Option, sc *serverConn) {
+	sending := new(sync.Mutex)                      //确保发送一个完整的响应
+	wg := new(sync.WaitGroup)                       //确保所有请求被处理
+	connSem := newSemaphore(server.maxConnRequests) //单个连接的并发限制
+	var waiting semaphore                           //开启backpressure时单个连接等待中的请求数
+	if server.backpressure {
+		waiting = newSemaphore(maxWaitingRequests)
+	}
+
+	//连接断开后取消所有正在处理的请求
+	connCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if server.idleTimeout > 0 {
+		go server.watchIdle(sc, cc, connCtx.Done())
+	}
+	if server.keepaliveInterval > 0 {
+		go server.keepalive(sc, cc, sending, connCtx.Done())
+	}
+	pongs := make(chan struct{}, 1)
+	go pongLoop(pongs, connCtx.Done(), func() error {
+		return server.sendFrame(cc, pongMethod, sending)
+	})
 
 	for {
-		req, err := server.readRequest(cc)
+		req, err := server.readRequest(cc, sc)
 		if err != nil {
 			if req == nil {
 				break // it's not possible to recover, so close the connection
 			}
-			req.h.Error = err.Error()
-			server.sendResponse(cc, req.h, invalidRequest, sending)
+			server.sendError(cc, req.h, err, sending)
 			continue
 		}
-		wg.Add(1)
+		if req.keepalive {
+			if req.h.ServiceMethod == pingMethod {
+				replyPong(pongs)
+			}
+			continue
+		}
+		if server.shuttingDown() {
+			server.sendError(cc, req.h, ErrServerShutdown, sending)
+			continue
+		}
+		//服务端设置为高优先级的方法不受限流、全局和单个连接的并发限制，过载时也能响应健康检查
+		if !req.mtype.exempt() {
+			if err := server.checkRateLimit(req, sc.remote); err != nil {
+				server.sendError(cc, req.h, err, sending)
+				continue
+			}
+		}
 
-		//使其不阻塞，for循环处理请求
-		go server.handleRequest(cc, req, sending, wg, opt.HandleTimeout)
+		priority := requestPriority(req)
+		adm := new(admission)
+		//单个连接的并发限制在读循环中检查，开启backpressure时暂停读取该连接的请求
+		if !req.mtype.exempt() && !adm.acquire(connSem, server.backpressure) {
+			server.sendError(cc, req.h, errTooManyRequests, sending)
+			continue
+		}
+		//等待全局、方法并发限制或者worker pool队列的请求也有上限，达到上限时同样暂停读取
+		if !req.mtype.exempt() {
+			adm.wait(waiting)
+		}
+		wg.Add(1)
+		atomic.AddInt64(&server.inFlight, 1)
+		sc.begin()
+		go server.admit(connCtx, cc, req, opt, sending, wg, sc, adm, priority)
 	}
 
+	cancel()
 	wg.Wait()
 }
 
+var errTooManyRequests = newError(CodeResourceExhausted, "rpc server: too many concurrent requests")
+
+// maxWaitingRequests 开启backpressure时每个连接最多有这么多请求在等待执行，避免每个请求都有一个阻塞的goroutine
+const maxWaitingRequests = 64
+
+// admission 一个请求占用的并发名额，handler真正返回后才释放
+type admission struct {
+	sems    []semaphore
+	waiting semaphore //占用的等待名额，开始执行或者被拒绝时释放
+}
+
+// wait 占用一个等待名额，没有空闲名额时阻塞读循环
+func (a *admission) wait(sem semaphore) {
+	sem.acquire(true)
+	a.waiting = sem
+}
+
+// admitted 开始执行，释放等待名额
+func (a *admission) admitted() {
+	a.waiting.release()
+	a.waiting = nil
+}
+
+func (a *admission) acquire(sem semaphore, block bool) bool {
+	if sem == nil {
+		return true
+	}
+	if !sem.acquire(block) {
+		return false
+	}
+	a.sems = append(a.sems, sem)
+	return true
+}
+
+func (a *admission) release() {
+	a.admitted()
+	for _, sem := range a.sems {
+		sem.release()
+	}
+	a.sems = nil
+}
+
+// admit 在读循环之外获取全局和方法的并发限制，某个方法达到上限时不会阻塞同一个连接上的其他方法
+func (server *Server) admit(connCtx context.Context, cc codec.Codec, req *request, opt *Option, sending *sync.Mutex, wg *sync.WaitGroup, sc *serverConn, adm *admission, priority Priority) {
+	finish := func() {
+		adm.release()
+		atomic.AddInt64(&server.inFlight, -1)
+		sc.end()
+	}
+	//队列已满，或者在队列中被更高优先级的请求挤掉
+	reject := func() {
+		finish()
+		server.sendError(cc, req.h, errTooManyRequests, sending)
+		wg.Done()
+	}
+	if (!req.mtype.exempt() && !adm.acquire(server.reqSem, server.backpressure)) || !adm.acquire(req.mtype.sem, server.backpressure) {
+		reject()
+		return
+	}
+
+	timeout := req.mtype.handleTimeout(opt.HandleTimeout)
+	run := func() {
+		adm.admitted()
+		defer finish()
+		server.handleRequest(connCtx, cc, req, sending, wg, timeout)
+	}
+	if !server.dispatch(run, reject, priority) {
+		reject()
+	}
+}
+
+// dispatch 交给worker pool按优先级调度，没有配置时在当前goroutine中执行
+func (server *Server) dispatch(run, reject func(), priority Priority) bool {
+	if server.pool == nil {
+		run()
+		return true
+	}
+	//高优先级的请求不等待队列空出位置，直接挤掉队列中优先级更低的请求
+	return server.pool.submit(run, reject, priority, server.backpressure && priority < PriorityHigh)
+}
+
 // request stores all information of a call
 type request struct {
 	h            *codec.Header // header of request
 	argv, replyv reflect.Value // argv and replyv of request
 	mtype        *methodType
 	svc          *service
+	keepalive    bool //心跳帧，不需要处理
 }
 
 func (server *Server) readRequestHeader(cc codec.Codec) (*codec.Header, error) {
 	var h codec.Header
 
 	if err := cc.ReadHeader(&h); err != nil {
-		if err != io.EOF && err != io.ErrUnexpectedEOF {
-			log.Println("rpc server: read header error:", err)
+		//EOF表示连接正常关闭，只在debug级别输出
+		if err != io.EOF && err != io.ErrUnexpectedEOF && !errors.Is(err, net.ErrClosed) {
+			server.logger.Error("rpc server: read header error", "err", err)
+		} else {
+			server.logger.Debug("rpc server: connection closed", "err", err)
 		}
-		log.Println("rpc server : readRequestHeader failed, err : ", err)
 		return nil, err
 	}
 	return &h, nil
 }
 
-func (server *Server) readRequest(cc codec.Codec) (*request, error) {
+// readRequest 收到请求的第一个字节之后，请求头和请求体必须在readTimeout内读完
+// 请求头可能已经在codec的缓冲中，这时从读完请求头开始计算
+func (server *Server) readRequest(cc codec.Codec, sc *serverConn) (*request, error) {
 	var req = &request{}
 
+	sc.armReadDeadline(server.readTimeout)
+	defer sc.clearReadDeadline()
 	h, err := server.readRequestHeader(cc) //获取请求头
 	if err != nil {
 		return nil, err
 	}
+	sc.startRead()
+	sc.received()
+	if isKeepalive(h) {
+		return &request{h: h, keepalive: true}, cc.ReadBody(nil)
+	}
+	sc.touch()
 
 	req.h = h
 	req.svc, req.mtype, err = server.findService(h.ServiceMethod) //获取服务指针和方法指针
 	if err != nil {
+		_ = cc.ReadBody(nil) //丢弃body，否则下一次会把body当作header读取
 		return req, err
 	}
 
@@ -252,7 +578,10 @@ func (server *Server) readRequest(cc codec.Codec) (*request, error) {
 	}
 
 	if err = cc.ReadBody(argvi); err != nil {
-		log.Println("rpc server: read argv err:", err)
+		server.logger.Error("rpc server: read argv error", "method", h.ServiceMethod, "err", err)
+		if isTimeout(err) {
+			return nil, err //请求体只读了一部分，无法继续解析后面的请求
+		}
 	}
 
 	return req, nil
@@ -262,43 +591,62 @@ func (server *Server) sendResponse(cc codec.Codec, h *codec.Header, body interfa
 	sending.Lock()
 	defer sending.Unlock()
 	if err := cc.Write(h, body); err != nil {
-		log.Println("rpc server: write response error:", err)
+		server.logger.Error("rpc server: write response error", "method", h.ServiceMethod, "err", err)
 	}
 }
 
-func (server *Server) handleRequest(cc codec.Codec, req *request, sending *sync.Mutex, wg *sync.WaitGroup, timeout time.Duration) {
-	defer wg.Done()
-
-	//用于超时控制
-	called := make(chan struct{})
-	sent := make(chan struct{})
-
-	go func() {
-		err := req.svc.call(req.mtype, req.argv, req.replyv) //调用call方法，结果写入到replyv中
-		called <- struct{}{}
-		if err != nil {
-			req.h.Error = err.Error()
-			server.sendResponse(cc, req.h, invalidRequest, sending)
-			sent <- struct{}{}
-			return
-		}
+// sendError 发送只包含错误的响应
+func (server *Server) sendError(cc codec.Codec, h *codec.Header, err error, sending *sync.Mutex) {
+	h.Metadata = nil //不回传请求的元数据
+	setHeaderError(h, err)
+	server.sendResponse(cc, h, invalidRequest, sending)
+}
 
-		server.sendResponse(cc, req.h, req.replyv.Interface(), sending)
-		sent <- struct{}{}
-	}()
+// handleRequest 每个请求只会发送一次响应：handler先返回则发送结果，超时或连接关闭则发送错误
+// handler在独立的goroutine中执行，超时时ctx被取消，接收ctx参数的handler可以及时退出
+// 发送响应后调用wg.Done，连接可以关闭；handler真正返回后才返回，之前一直占用并发名额和worker
+func (server *Server) handleRequest(connCtx context.Context, cc codec.Codec, req *request, sending *sync.Mutex, wg *sync.WaitGroup, timeout time.Duration) {
+	//从元数据中恢复追踪上下文，传给handler
+	md := Metadata(req.h.Metadata)
+	req.h.Metadata = nil //响应不需要回传请求的元数据
+	ctx := newIncomingContext(connCtx, md)
+	if sc, ok := extractTrace(md); ok {
+		ctx = ContextWithSpanContext(ctx, sc)
+	}
+	ctx, span := server.tracer.StartSpan(ctx, req.h.ServiceMethod, SpanKindServer)
 
 	//timeout为0表示不做限制
-	if timeout == 0 {
-		<-called
-		<-sent
-		return
+	var cancel context.CancelFunc
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
 	}
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- req.svc.callContext(ctx, req.mtype, req.argv, req.replyv) //调用call方法，结果写入到replyv中
+	}()
 
 	select {
-	case <-time.After(timeout):
-		req.h.Error = fmt.Sprintf("rpc server: request handle timeout: expect within %s", timeout)
-		server.sendResponse(cc, req.h, invalidRequest, sending)
-	case <-called:
-		<-sent
+	case err := <-done:
+		span.Finish(err)
+		if err != nil {
+			server.sendError(cc, req.h, err, sending)
+		} else {
+			server.sendResponse(cc, req.h, req.replyv.Interface(), sending)
+		}
+		wg.Done()
+	case <-ctx.Done():
+		err := ctx.Err()
+		if errors.Is(err, context.DeadlineExceeded) {
+			err = newError(CodeDeadlineExceeded, fmt.Sprintf("rpc server: request handle timeout: expect within %s", timeout))
+			span.SetAttribute("rpc.timeout", timeout.String())
+		}
+		span.Finish(err)
+		server.sendError(cc, req.h, err, sending)
+		wg.Done()
+		<-done //没有及时退出的handler仍然占用并发名额
 	}
 }
@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"log"
 	"net"
+	"runtime"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -100,3 +102,273 @@ func TestStandard(t *testing.T) {
 	wg.Wait()
 
 }
+
+type Version int
+
+func (v Version) Get(args int, reply *int) error {
+	*reply = int(v)
+	return nil
+}
+
+// 测试运行时替换、移除服务
+func TestReplaceAndUnregister(t *testing.T) {
+	server := goRPC.NewServer()
+	if err := server.RegisterName("Version", Version(1)); err != nil {
+		t.Fatal(err)
+	}
+	l, _ := net.Listen("tcp", ":0")
+	go server.Accept(l)
+
+	client, err := goRPC.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	var reply int
+	if err := client.Call(context.Background(), "Version.Get", 0, &reply); err != nil || reply != 1 {
+		t.Fatalf("expect 1, got %d %v", reply, err)
+	}
+
+	if err := server.Replace("Version", Version(2)); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Call(context.Background(), "Version.Get", 0, &reply); err != nil || reply != 2 {
+		t.Fatalf("expect 2 after replace, got %d %v", reply, err)
+	}
+
+	if err := server.Unregister("Version"); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Call(context.Background(), "Version.Get", 0, &reply); err == nil {
+		t.Fatal("expect error after unregister")
+	}
+	if err := server.Replace("Version", Version(3)); err == nil {
+		t.Fatal("expect error when replacing unknown service")
+	}
+}
+
+type Slow int
+
+func (s Slow) Wait(ctx context.Context, d time.Duration, reply *int) error {
+	select {
+	case <-time.After(d):
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return nil
+}
+
+// 测试大量请求超时后没有goroutine泄漏
+func TestHandleTimeoutNoLeak(t *testing.T) {
+	server := goRPC.NewServer()
+	var s Slow
+	_ = server.Register(&s, goRPC.WithMethodTimeout("Wait", 20*time.Millisecond))
+	l, _ := net.Listen("tcp", ":0")
+	go server.Accept(l)
+	defer l.Close()
+
+	client, err := goRPC.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	var reply int
+	_ = client.Call(context.Background(), "Slow.Wait", time.Duration(0), &reply)
+	base := runtime.NumGoroutine()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 200; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var reply int
+			err := client.Call(context.Background(), "Slow.Wait", time.Hour, &reply)
+			if err == nil || !strings.Contains(err.Error(), "timeout") {
+				t.Errorf("expect timeout error, got %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for runtime.NumGoroutine() > base && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := runtime.NumGoroutine(); n > base {
+		t.Fatalf("goroutine leak: %d before, %d after", base, n)
+	}
+	if !client.IsAvailable() {
+		t.Fatal("connection should still be available")
+	}
+}
+
+// 并发调用n次Slow.Wait，返回被拒绝的次数
+func callSlowConcurrently(t *testing.T, server *goRPC.Server, n int) int {
+	var s Slow
+	_ = server.Register(&s)
+	l, _ := net.Listen("tcp", ":0")
+	go server.Accept(l)
+	defer l.Close()
+
+	client, err := goRPC.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	rejected := 0
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var reply int
+			err := client.Call(context.Background(), "Slow.Wait", 200*time.Millisecond, &reply)
+			if err == nil {
+				return
+			}
+			if goRPC.ErrorCode(err) != goRPC.CodeResourceExhausted {
+				t.Errorf("expect ResourceExhausted, got %v", err)
+			}
+			mu.Lock()
+			rejected++
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	return rejected
+}
+
+func TestConcurrencyLimit(t *testing.T) {
+	if n := callSlowConcurrently(t, goRPC.NewServer(goRPC.WithMaxConcurrentRequests(2)), 5); n != 3 {
+		t.Fatalf("expect 3 rejected, got %d", n)
+	}
+	if n := callSlowConcurrently(t, goRPC.NewServer(goRPC.WithMaxConnRequests(2), goRPC.WithBackpressure()), 5); n != 0 {
+		t.Fatalf("expect no rejected with backpressure, got %d", n)
+	}
+	//1个worker正在执行，1个在队列中等待
+	if n := callSlowConcurrently(t, goRPC.NewServer(goRPC.WithWorkerPool(1, 1)), 4); n != 2 {
+		t.Fatalf("expect 2 rejected by worker pool, got %d", n)
+	}
+}
+
+// Busy 的handler不检查ctx，超时之后仍然会执行完
+type Busy int
+
+func (b Busy) Sleep(d time.Duration, reply *int) error {
+	time.Sleep(d)
+	return nil
+}
+
+func (b Busy) Echo(n int, reply *int) error {
+	*reply = n
+	return nil
+}
+
+func startBusy(t *testing.T, server *goRPC.Server, opts ...goRPC.RegisterOption) *goRPC.Client {
+	var b Busy
+	if err := server.Register(&b, opts...); err != nil {
+		t.Fatal(err)
+	}
+	l, _ := net.Listen("tcp", ":0")
+	go server.Accept(l)
+	t.Cleanup(func() { l.Close() })
+
+	client, err := goRPC.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+// 开启backpressure时，一个方法达到并发上限不会阻塞同一个连接上的其他方法
+func TestBackpressureOtherMethods(t *testing.T) {
+	client := startBusy(t, goRPC.NewServer(goRPC.WithBackpressure()), goRPC.WithMethodMaxConcurrency("Sleep", 1))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var reply int
+			if err := client.Call(context.Background(), "Busy.Sleep", 300*time.Millisecond, &reply); err != nil {
+				t.Errorf("expect queued call to succeed, got %v", err)
+			}
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	var reply int
+	if err := client.Call(ctx, "Busy.Echo", 7, &reply); err != nil || reply != 7 {
+		t.Fatalf("expect Echo not blocked by Sleep, got %d %v", reply, err)
+	}
+	wg.Wait()
+}
+
+// 超时的handler没有返回之前仍然占用并发名额
+func TestTimedOutHandlerHoldsSlot(t *testing.T) {
+	client := startBusy(t, goRPC.NewServer(goRPC.WithMaxConcurrentRequests(1)), goRPC.WithMethodTimeout("Sleep", 20*time.Millisecond))
+
+	var reply int
+	err := client.Call(context.Background(), "Busy.Sleep", 300*time.Millisecond, &reply)
+	if goRPC.ErrorCode(err) != goRPC.CodeDeadlineExceeded {
+		t.Fatalf("expect DeadlineExceeded, got %v", err)
+	}
+	if err := client.Call(context.Background(), "Busy.Echo", 1, &reply); goRPC.ErrorCode(err) != goRPC.CodeResourceExhausted {
+		t.Fatalf("expect ResourceExhausted while handler is running, got %v", err)
+	}
+	time.Sleep(400 * time.Millisecond)
+	if err := client.Call(context.Background(), "Busy.Echo", 1, &reply); err != nil {
+		t.Fatalf("expect slot released after handler returned, got %v", err)
+	}
+}
+
+// 并发达到上限时，健康检查不受限制；客户端设置高优先级不能绕过限制
+func TestHighPriorityExempt(t *testing.T) {
+	client := startBusy(t, goRPC.NewServer(goRPC.WithMaxConcurrentRequests(1)))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		var reply int
+		_ = client.Call(context.Background(), "Busy.Sleep", 300*time.Millisecond, &reply)
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	var health goRPC.HealthCheckResponse
+	if err := client.Call(context.Background(), "Health.Check", goRPC.HealthCheckRequest{}, &health); err != nil {
+		t.Fatalf("expect health check admitted, got %v", err)
+	}
+	var reply int
+	ctx := goRPC.WithPriority(context.Background(), goRPC.PriorityHigh)
+	if err := client.Call(ctx, "Busy.Echo", 1, &reply); goRPC.ErrorCode(err) != goRPC.CodeResourceExhausted {
+		t.Fatalf("expect ResourceExhausted for client priority, got %v", err)
+	}
+	<-done
+}
+
+// 开启backpressure时，大量请求等待同一个方法的并发限制，服务端的goroutine数量仍然有上限
+func TestBackpressureBoundedWaiting(t *testing.T) {
+	client := startBusy(t, goRPC.NewServer(goRPC.WithBackpressure(), goRPC.WithMaxConcurrentRequests(1)))
+
+	var reply int
+	_ = client.Call(context.Background(), "Busy.Echo", 1, &reply) //建立连接相关的goroutine
+	before := runtime.NumGoroutine()
+
+	//单个goroutine发送，服务端暂停读取后阻塞在写连接上
+	go func() {
+		for i := 0; i < 500; i++ {
+			client.Go("Busy.Sleep", time.Second, new(int), make(chan *goRPC.Call, 1))
+		}
+	}()
+	time.Sleep(300 * time.Millisecond)
+	if n := runtime.NumGoroutine() - before; n > 100 {
+		t.Fatalf("expect bounded goroutines while requests wait, got %d more", n)
+	}
+}
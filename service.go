@@ -1,10 +1,14 @@
 package goRPC
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"go/ast"
-	"log"
 	"reflect"
+	"strings"
 	"sync/atomic"
+	"time"
 )
 
 //	定义方法类型结构体，方便后续封装
@@ -14,12 +18,24 @@ type methodType struct {
 	ArgType   reflect.Type   //入参
 	ReplyType reflect.Type   //出参
 	numCalls  uint64
+	withCtx   bool          //第一个参数是否为context.Context
+	timeout   time.Duration //服务端配置的处理超时时间，0表示不限制
+	sem       semaphore     //方法的并发限制
+	priority  Priority      //方法的默认优先级
 }
 
 func (m *methodType) NumCalls() uint64 {
 	return atomic.LoadUint64(&m.numCalls)
 }
 
+// handleTimeout 方法配置了超时时间时，既作为默认值，也作为客户端请求的超时时间的上限
+func (m *methodType) handleTimeout(requested time.Duration) time.Duration {
+	if m.timeout > 0 && (requested == 0 || requested > m.timeout) {
+		return m.timeout
+	}
+	return requested
+}
+
 func (m *methodType) newArgv() reflect.Value {
 	var argv reflect.Value
 	if m.ArgType.Kind() == reflect.Ptr {
@@ -49,66 +65,270 @@ type service struct {
 	typ    reflect.Type           //结构体类型
 	rcvr   reflect.Value          //结构体本身，保留 rcvr 是因为在调用call方法时需要 rcvr 作为第 0 个参数
 	method map[string]*methodType //method 是 map 类型，存储映射的结构体的所有符合条件的方法
+
+	skipped []error //签名不符合要求而被跳过的方法
+}
+
+// RegisterOption 注册服务时的可选配置
+type RegisterOption func(*registerOptions)
+
+type registerOptions struct {
+	name     string            //服务名，为空时使用类型名
+	strict   bool              //存在签名不符合要求的导出方法时注册失败
+	include  map[string]bool   //只注册这些方法，为nil时注册全部
+	exclude  map[string]bool   //不注册这些方法
+	alias    map[string]string //方法名 -> 对外暴露的名字
+	timeout  map[string]time.Duration
+	limit    map[string]int
+	priority map[string]Priority
+}
+
+// WithStrictMethods 严格模式，任何导出方法的签名不符合要求都会使注册失败，而不是被静默跳过
+func WithStrictMethods() RegisterOption {
+	return func(o *registerOptions) {
+		o.strict = true
+	}
+}
+
+// WithMethods 只注册指定的方法，其余方法不对外暴露
+func WithMethods(methods ...string) RegisterOption {
+	return func(o *registerOptions) {
+		if o.include == nil {
+			o.include = make(map[string]bool)
+		}
+		for _, m := range methods {
+			o.include[m] = true
+		}
+	}
+}
+
+// WithoutMethods 不注册指定的方法
+func WithoutMethods(methods ...string) RegisterOption {
+	return func(o *registerOptions) {
+		if o.exclude == nil {
+			o.exclude = make(map[string]bool)
+		}
+		for _, m := range methods {
+			o.exclude[m] = true
+		}
+	}
+}
+
+// WithMethodName 将方法method以name对外暴露，比如 Sum 暴露为 Add，调用时使用 Foo.Add
+func WithMethodName(method, name string) RegisterOption {
+	return func(o *registerOptions) {
+		if o.alias == nil {
+			o.alias = make(map[string]string)
+		}
+		o.alias[method] = name
+	}
+}
+
+// WithMethodTimeout 设置方法的处理超时时间，客户端Option.HandleTimeout更大或者为0时都以它为准
+// 比如 Report.Generate 允许执行1分钟，而 Foo.Sum 最多100ms
+func WithMethodTimeout(method string, timeout time.Duration) RegisterOption {
+	return func(o *registerOptions) {
+		if o.timeout == nil {
+			o.timeout = make(map[string]time.Duration)
+		}
+		o.timeout[method] = timeout
+	}
+}
+
+// WithMethodMaxConcurrency 方法同时处理的请求数上限
+func WithMethodMaxConcurrency(method string, n int) RegisterOption {
+	return func(o *registerOptions) {
+		if o.limit == nil {
+			o.limit = make(map[string]int)
+		}
+		o.limit[method] = n
+	}
+}
+
+// 由RegisterName使用，指定服务名
+func withServiceName(name string) RegisterOption {
+	return func(o *registerOptions) {
+		o.name = name
+	}
 }
 
 // rcvr表示需要映射为服务的结构体实例
-func newService(rcvr interface{}) *service {
+func newService(rcvr interface{}, opts ...RegisterOption) (*service, error) {
+	var o registerOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if rcvr == nil {
+		return nil, errors.New("rpc server: register nil receiver")
+	}
 	s := new(service)
 	s.rcvr = reflect.ValueOf(rcvr)
 	s.name = reflect.Indirect(s.rcvr).Type().Name()
 	s.typ = reflect.TypeOf(rcvr)
 
-	// IsExported 报告名称是否为导出的 Go 符号（即，它是否以大写字母开头）
-	if !ast.IsExported(s.name) {
-		log.Fatalf("rpc server: %s is not a valid service name", s.name)
+	if o.name != "" {
+		//显式指定服务名时不要求类型可导出，和net/rpc的RegisterName一致
+		s.name = o.name
+	} else if !ast.IsExported(s.name) {
+		// IsExported 报告名称是否为导出的 Go 符号（即，它是否以大写字母开头）
+		return nil, fmt.Errorf("rpc server: type %s is not exported, can't be used as service name", s.typ)
 	}
 
-	s.registerMethods()
-	return s
+	skipped, err := s.registerMethods(&o)
+	if err != nil {
+		return nil, err
+	}
+	if len(s.method) == 0 {
+		return nil, fmt.Errorf("rpc server: type %s has no eligible methods%s", s.name, skippedReasons(skipped))
+	}
+	if o.strict && len(skipped) > 0 {
+		return nil, fmt.Errorf("rpc server: type %s has ineligible methods%s", s.name, skippedReasons(skipped))
+	}
+	s.skipped = skipped
+	return s, nil
 }
 
-func (s *service) registerMethods() {
+// registerMethods 注册所有符合条件的方法，返回被跳过的方法及原因
+func (s *service) registerMethods(o *registerOptions) ([]error, error) {
 	s.method = make(map[string]*methodType)
+	var skipped []error
+	found := make(map[string]bool)
 
 	for i := 0; i < s.typ.NumMethod(); i++ {
 		method := s.typ.Method(i)
-		mType := method.Type
-
-		//两个导出或内置类型的入参（反射时为 3 个，第 0 个是自身，类似于 python 的 self，java 中的 this）
-		//返回值有且只有 1 个，类型为 error
-		if mType.NumIn() != 3 || mType.NumOut() != 1 {
+		found[method.Name] = true
+		if (o.include != nil && !o.include[method.Name]) || o.exclude[method.Name] {
 			continue
 		}
 
-		if mType.Out(0) != reflect.TypeOf((*error)(nil)).Elem() {
+		mt, err := suitableMethod(method)
+		if err != nil {
+			//显式指定的方法不符合要求时直接报错
+			if o.include[method.Name] || o.alias[method.Name] != "" {
+				return nil, err
+			}
+			skipped = append(skipped, err)
 			continue
 		}
 
-		argType, replyType := mType.In(1), mType.In(2)
-		if !isExportedOrBuiltinType(argType) || !isExportedOrBuiltinType(replyType) {
-			continue
+		name := method.Name
+		if alias, ok := o.alias[method.Name]; ok {
+			if alias == "" || strings.Contains(alias, ".") {
+				return nil, fmt.Errorf("rpc server: invalid name %q for method %s", alias, method.Name)
+			}
+			name = alias
 		}
-
+		if _, dup := s.method[name]; dup {
+			return nil, fmt.Errorf("rpc server: method %s.%s defined more than once", s.name, name)
+		}
+		mt.timeout = o.timeout[method.Name]
+		mt.sem = newSemaphore(o.limit[method.Name])
+		mt.priority = o.priority[method.Name]
 		//加入map
-		s.method[method.Name] = &methodType{
-			method:    method,
-			ArgType:   argType,
-			ReplyType: replyType,
+		s.method[name] = mt
+	}
+
+	//检查选项中的方法名是否存在，防止拼写错误
+	var names []string
+	for name := range o.include {
+		names = append(names, name)
+	}
+	for name := range o.exclude {
+		names = append(names, name)
+	}
+	for name := range o.alias {
+		names = append(names, name)
+	}
+	for name := range o.timeout {
+		names = append(names, name)
+	}
+	for name := range o.limit {
+		names = append(names, name)
+	}
+	for name := range o.priority {
+		names = append(names, name)
+	}
+	for _, name := range names {
+		if !found[name] {
+			return nil, fmt.Errorf("rpc server: type %s has no exported method %s", s.name, name)
 		}
+	}
+	return skipped, nil
+}
 
-		log.Printf("rpc server: register %s.%s\n", s.name, method.Name)
+// suitableMethod 检查方法签名，不符合要求时返回原因
+func suitableMethod(method reflect.Method) (*methodType, error) {
+	mType := method.Type
+
+	//两个导出或内置类型的入参（反射时为 3 个，第 0 个是自身，类似于 python 的 self，java 中的 this）
+	//可选地在最前面多一个 context.Context 参数，用于获取元数据、追踪信息
+	//返回值有且只有 1 个，类型为 error
+	withCtx := mType.NumIn() == 4 && mType.In(1) == typeOfContext
+	if mType.NumIn() != 3 && !withCtx {
+		return nil, fmt.Errorf("%s: expect (args, *reply) or (ctx, args, *reply) parameters, got %d", method.Name, mType.NumIn()-1)
+	}
+
+	if mType.NumOut() != 1 || mType.Out(0) != typeOfError {
+		return nil, fmt.Errorf("%s: must return exactly one error", method.Name)
+	}
+
+	argType, replyType := mType.In(mType.NumIn()-2), mType.In(mType.NumIn()-1)
+	if !isExportedOrBuiltinType(argType) {
+		return nil, fmt.Errorf("%s: argument type %s is not exported", method.Name, argType)
+	}
+	if replyType.Kind() != reflect.Ptr {
+		return nil, fmt.Errorf("%s: reply type %s is not a pointer", method.Name, replyType)
+	}
+	if !isExportedOrBuiltinType(replyType) {
+		return nil, fmt.Errorf("%s: reply type %s is not exported", method.Name, replyType)
+	}
+
+	return &methodType{
+		method:    method,
+		ArgType:   argType,
+		ReplyType: replyType,
+		withCtx:   withCtx,
+	}, nil
+}
+
+func skippedReasons(skipped []error) string {
+	if len(skipped) == 0 {
+		return ""
+	}
+	reasons := make([]string, 0, len(skipped))
+	for _, err := range skipped {
+		reasons = append(reasons, err.Error())
 	}
+	return ": " + strings.Join(reasons, "; ")
 }
 
+var (
+	typeOfError   = reflect.TypeOf((*error)(nil)).Elem()
+	typeOfContext = reflect.TypeOf((*context.Context)(nil)).Elem()
+)
+
 func isExportedOrBuiltinType(t reflect.Type) bool {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
 	return ast.IsExported(t.Name()) || t.PkgPath() == ""
 }
 
 func (s *service) call(m *methodType, argv, rplyv reflect.Value) error {
+	return s.callContext(context.Background(), m, argv, rplyv)
+}
+
+// callContext 调用方法，如果方法需要ctx则作为第一个参数传入
+func (s *service) callContext(ctx context.Context, m *methodType, argv, rplyv reflect.Value) error {
 	atomic.AddUint64(&m.numCalls, 1)
 	f := m.method.Func
 
-	returnValues := f.Call([]reflect.Value{s.rcvr, argv, rplyv})
+	in := []reflect.Value{s.rcvr, argv, rplyv}
+	if m.withCtx {
+		in = []reflect.Value{s.rcvr, reflect.ValueOf(ctx), argv, rplyv}
+	}
+	returnValues := f.Call(in)
 
 	if errInter := returnValues[0].Interface(); errInter != nil {
 		return errInter.(error)
@@ -3,7 +3,9 @@ package goRPC
 import (
 	"log"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 type Foo int
@@ -26,7 +28,7 @@ func (f Foo) sum(args Args, reply *int) error {
 
 func TestNewService(t *testing.T) {
 	var foo Foo
-	s := newService(&foo)
+	s, _ := newService(&foo)
 	log.Println(s)
 	log.Println(len(s.method)) //应该只输出可导出的方法个数
 
@@ -36,7 +38,7 @@ func TestNewService(t *testing.T) {
 
 func TestMethodType_Call(t *testing.T) {
 	var foo Foo
-	s := newService(&foo)
+	s, _ := newService(&foo)
 	mType := s.method["Sum"]
 
 	argv := mType.newArgv()
@@ -51,3 +53,99 @@ func TestMethodType_Call(t *testing.T) {
 	log.Println("res = ", *replyv.Interface().(*int))
 	log.Println(mType.NumCalls())
 }
+
+type unexportedService int
+
+func (u unexportedService) Sum(args Args, reply *int) error { return nil }
+
+type NoMethods int
+
+func (n NoMethods) Bad(args Args, reply int) error { return nil }
+
+type Mixed int
+
+func (m Mixed) Sum(args Args, reply *int) error { return nil }
+
+func (m Mixed) Bad(args Args) error { return nil }
+
+func TestNewServiceErrors(t *testing.T) {
+	var u unexportedService
+	if _, err := newService(&u); err == nil {
+		t.Fatal("expect error for unexported type")
+	}
+
+	var n NoMethods
+	_, err := newService(&n)
+	if err == nil || !strings.Contains(err.Error(), "Bad: reply type int is not a pointer") {
+		t.Fatalf("expect reason of skipped method, got %v", err)
+	}
+
+	var m Mixed
+	s, err := newService(&m)
+	if err != nil || len(s.method) != 1 || len(s.skipped) != 1 {
+		t.Fatalf("expect Sum registered and Bad skipped, got %v", err)
+	}
+	if _, err := newService(&m, WithStrictMethods()); err == nil {
+		t.Fatal("expect error in strict mode")
+	}
+}
+
+type Calc int
+
+func (c Calc) Sum(args Args, reply *int) error { return nil }
+
+func (c Calc) Sub(args Args, reply *int) error { return nil }
+
+func (c Calc) Bad(args Args) error { return nil }
+
+func TestRegisterOptions(t *testing.T) {
+	var c Calc
+	s, err := newService(&c, withServiceName("v2.Calc"), WithMethods("Sum", "Sub"), WithMethodName("Sub", "Minus"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.name != "v2.Calc" || len(s.method) != 2 || s.method["Minus"] == nil || s.method["Sub"] != nil {
+		t.Fatalf("unexpected methods %v", s.method)
+	}
+
+	s, err = newService(&c, WithoutMethods("Sub"))
+	if err != nil || s.method["Sub"] != nil || s.method["Sum"] == nil {
+		t.Fatalf("expect Sub excluded, got %v %v", s, err)
+	}
+
+	if _, err := newService(&c, WithMethods("Missing")); err == nil {
+		t.Fatal("expect error for unknown method")
+	}
+	if _, err := newService(&c, WithMethods("Bad")); err == nil {
+		t.Fatal("expect error for explicitly included ineligible method")
+	}
+}
+
+func TestMethodTimeout(t *testing.T) {
+	var c Calc
+	s, err := newService(&c, WithMethodTimeout("Sum", 100*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum, sub := s.method["Sum"], s.method["Sub"]
+	cases := []struct {
+		m         *methodType
+		requested time.Duration
+		want      time.Duration
+	}{
+		{sum, 0, 100 * time.Millisecond},
+		{sum, time.Minute, 100 * time.Millisecond},
+		{sum, 10 * time.Millisecond, 10 * time.Millisecond},
+		{sub, time.Minute, time.Minute},
+		{sub, 0, 0},
+	}
+	for _, c := range cases {
+		if got := c.m.handleTimeout(c.requested); got != c.want {
+			t.Fatalf("requested %s, expect %s, got %s", c.requested, c.want, got)
+		}
+	}
+
+	if _, err := newService(&c, WithMethodTimeout("Missing", time.Second)); err == nil {
+		t.Fatal("expect error for unknown method")
+	}
+}
@@ -0,0 +1,101 @@
+package goRPC
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// ErrServerShutdown Shutdown之后收到的请求会返回该错误
+var ErrServerShutdown error = newError(CodeUnavailable, "rpc server: server is shutting down")
+
+const shutdownPollInterval = 50 * time.Millisecond
+
+// Shutdown 优雅关闭：健康状态置为NOT_SERVING，关闭所有监听，等待正在处理的请求完成后关闭连接
+// ctx结束时直接关闭所有连接，拒绝worker pool中排队的请求，返回ctx.Err()
+func (server *Server) Shutdown(ctx context.Context) error {
+	atomic.StoreInt32(&server.inShutdown, 1)
+	server.health.setShutdown()
+
+	server.trackMu.Lock()
+	for lis := range server.listeners {
+		_ = lis.Close()
+	}
+	server.trackMu.Unlock()
+
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+	for {
+		if atomic.LoadInt64(&server.inFlight) == 0 {
+			server.closeConns()
+			if server.pool != nil {
+				server.pool.stop()
+			}
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			server.closeConns()
+			if server.pool != nil {
+				server.pool.abort()
+			}
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (server *Server) shuttingDown() bool {
+	return atomic.LoadInt32(&server.inShutdown) == 1
+}
+
+func (server *Server) trackListener(lis net.Listener, add bool) bool {
+	server.trackMu.Lock()
+	defer server.trackMu.Unlock()
+	if add {
+		if server.shuttingDown() {
+			return false
+		}
+		server.listeners[lis] = struct{}{}
+	} else {
+		delete(server.listeners, lis)
+	}
+	return true
+}
+
+// trackConn 添加连接时检查连接数限制，host为客户端IP
+func (server *Server) trackConn(conn io.Closer, host string, add bool) error {
+	server.trackMu.Lock()
+	defer server.trackMu.Unlock()
+	if !add {
+		if _, ok := server.conns[conn]; ok {
+			delete(server.conns, conn)
+			if server.connsPerIP[host]--; server.connsPerIP[host] <= 0 {
+				delete(server.connsPerIP, host)
+			}
+		}
+		return nil
+	}
+	if server.shuttingDown() {
+		return ErrServerShutdown
+	}
+	if server.maxConns > 0 && len(server.conns) >= server.maxConns {
+		return errTooManyConns
+	}
+	if server.maxConnsPerIP > 0 && server.connsPerIP[host] >= server.maxConnsPerIP {
+		return errTooManyConns
+	}
+	server.conns[conn] = struct{}{}
+	server.connsPerIP[host]++
+	return nil
+}
+
+func (server *Server) closeConns() {
+	server.trackMu.Lock()
+	defer server.trackMu.Unlock()
+	for conn := range server.conns {
+		_ = conn.Close() //由ServeConn退出时移除，同时更新每个IP的连接数
+	}
+}
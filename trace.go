@@ -0,0 +1,272 @@
+package goRPC
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 分布式追踪，按照 W3C Trace Context 规范在元数据中传递 traceparent / tracestate
+// traceparent 格式：version-traceid-spanid-flags，比如 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01
+
+const (
+	traceparentKey = "traceparent"
+	tracestateKey  = "tracestate"
+)
+
+type TraceID [16]byte
+
+type SpanID [8]byte
+
+func (t TraceID) IsValid() bool { return t != TraceID{} }
+
+func (t TraceID) String() string { return hex.EncodeToString(t[:]) }
+
+func (s SpanID) IsValid() bool { return s != SpanID{} }
+
+func (s SpanID) String() string { return hex.EncodeToString(s[:]) }
+
+// SpanContext 跨进程传递的追踪上下文
+type SpanContext struct {
+	TraceID    TraceID
+	SpanID     SpanID
+	Flags      byte   //01表示sampled
+	TraceState string //厂商自定义信息，原样透传
+	Remote     bool   //是否从对端解析得到
+}
+
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+// Traceparent 编码为 traceparent 头
+func (sc SpanContext) Traceparent() string {
+	return fmt.Sprintf("00-%s-%s-%02x", sc.TraceID, sc.SpanID, sc.Flags)
+}
+
+// ParseTraceparent 解析 traceparent 头
+func ParseTraceparent(s string) (SpanContext, error) {
+	var sc SpanContext
+	parts := strings.Split(strings.TrimSpace(s), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return sc, errors.New("rpc trace: invalid traceparent " + s)
+	}
+	//version ff是非法的，version 00 只允许4段
+	if parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return sc, errors.New("rpc trace: invalid traceparent version " + s)
+	}
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return sc, err
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return sc, err
+	}
+	var flags [1]byte
+	if _, err := hex.Decode(flags[:], []byte(parts[3])); err != nil {
+		return sc, err
+	}
+	sc.Flags = flags[0]
+	if !sc.IsValid() {
+		return sc, errors.New("rpc trace: all zero trace id or span id " + s)
+	}
+	return sc, nil
+}
+
+type spanContextKey struct{}
+
+// ContextWithSpanContext 将追踪上下文放入ctx，后续创建的span会以它为父节点
+func ContextWithSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, spanContextKey{}, sc)
+}
+
+// SpanContextFromContext 获取ctx中当前的追踪上下文
+func SpanContextFromContext(ctx context.Context) SpanContext {
+	sc, _ := ctx.Value(spanContextKey{}).(SpanContext)
+	return sc
+}
+
+// 客户端：将ctx中的追踪上下文写入元数据
+func injectTrace(ctx context.Context, md Metadata) {
+	sc := SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return
+	}
+	md.Set(traceparentKey, sc.Traceparent())
+	if sc.TraceState != "" {
+		md.Set(tracestateKey, sc.TraceState)
+	}
+}
+
+// 服务端：从元数据中解析追踪上下文
+func extractTrace(md Metadata) (SpanContext, bool) {
+	tp := md.Get(traceparentKey)
+	if tp == "" {
+		return SpanContext{}, false
+	}
+	sc, err := ParseTraceparent(tp)
+	if err != nil {
+		return SpanContext{}, false
+	}
+	sc.TraceState = md.Get(tracestateKey)
+	sc.Remote = true
+	return sc, true
+}
+
+type SpanKind int
+
+const (
+	SpanKindInternal SpanKind = iota //XClient内部，比如重试、广播
+	SpanKindClient                   //客户端发起调用
+	SpanKindServer                   //服务端处理请求
+)
+
+func (k SpanKind) String() string {
+	switch k {
+	case SpanKindClient:
+		return "client"
+	case SpanKindServer:
+		return "server"
+	default:
+		return "internal"
+	}
+}
+
+// SpanData 结束后交给Exporter的span快照
+type SpanData struct {
+	Name        string
+	Kind        SpanKind
+	SpanContext SpanContext
+	Parent      SpanID //根span的Parent无效
+	Start       time.Time
+	End         time.Time
+	Attributes  map[string]string
+	Err         error
+}
+
+// SpanExporter 可插拔的导出接口，比如导出到日志、Jaeger等
+type SpanExporter interface {
+	ExportSpan(span SpanData)
+}
+
+// Span 一次操作，Tracer为nil时StartSpan返回nil，nil的Span上调用方法是安全的
+type Span struct {
+	tracer *Tracer
+	mu     sync.Mutex
+	data   SpanData
+	ended  bool
+}
+
+func (s *Span) SpanContext() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.data.SpanContext
+}
+
+func (s *Span) SetAttribute(key, value string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.data.Attributes == nil {
+		s.data.Attributes = make(map[string]string)
+	}
+	s.data.Attributes[key] = value
+}
+
+// Finish 结束span并导出，重复调用只生效一次
+func (s *Span) Finish(err error) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = time.Now()
+	s.data.Err = err
+	data := s.data
+	s.mu.Unlock()
+
+	if s.tracer.exporter != nil {
+		s.tracer.exporter.ExportSpan(data)
+	}
+}
+
+type Tracer struct {
+	exporter SpanExporter
+}
+
+func NewTracer(exporter SpanExporter) *Tracer {
+	return &Tracer{exporter: exporter}
+}
+
+// StartSpan 以ctx中的span为父节点创建新span，返回携带新span的ctx
+func (t *Tracer) StartSpan(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	if t == nil {
+		return ctx, nil
+	}
+	parent := SpanContextFromContext(ctx)
+	sc := SpanContext{Flags: 0x01}
+	if parent.IsValid() {
+		sc.TraceID = parent.TraceID
+		sc.Flags = parent.Flags
+		sc.TraceState = parent.TraceState
+	} else {
+		_, _ = rand.Read(sc.TraceID[:])
+	}
+	_, _ = rand.Read(sc.SpanID[:])
+
+	s := &Span{
+		tracer: t,
+		data: SpanData{
+			Name:        name,
+			Kind:        kind,
+			SpanContext: sc,
+			Parent:      parent.SpanID,
+			Start:       time.Now(),
+		},
+	}
+	return ContextWithSpanContext(ctx, sc), s
+}
+
+// InMemoryExporter 将span保存在内存中，用于测试
+type InMemoryExporter struct {
+	mu    sync.Mutex
+	spans []SpanData
+}
+
+var _ SpanExporter = (*InMemoryExporter)(nil)
+
+func NewInMemoryExporter() *InMemoryExporter {
+	return &InMemoryExporter{}
+}
+
+func (e *InMemoryExporter) ExportSpan(span SpanData) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, span)
+}
+
+// Spans 返回已导出span的拷贝
+func (e *InMemoryExporter) Spans() []SpanData {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	spans := make([]SpanData, len(e.spans))
+	copy(spans, e.spans)
+	return spans
+}
+
+func (e *InMemoryExporter) Reset() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = nil
+}
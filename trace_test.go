@@ -0,0 +1,119 @@
+package goRPC_test
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	goRPC "github.com/wjh791072385/gorpc"
+)
+
+type Trace int
+
+type TraceArgs struct{ Num1, Num2 int }
+
+// 带ctx的方法，返回收到的traceparent
+func (t Trace) Parent(ctx context.Context, args TraceArgs, reply *string) error {
+	md, _ := goRPC.MetadataFromContext(ctx)
+	*reply = md.Get("traceparent")
+	return nil
+}
+
+func TestParseTraceparent(t *testing.T) {
+	tp := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	sc, err := goRPC.ParseTraceparent(tp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sc.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || sc.SpanID.String() != "00f067aa0ba902b7" || sc.Flags != 1 {
+		t.Fatalf("unexpected span context %+v", sc)
+	}
+	if sc.Traceparent() != tp {
+		t.Fatalf("expect %s, got %s", tp, sc.Traceparent())
+	}
+
+	for _, bad := range []string{"", "00-0000-00f067aa0ba902b7-01", "00-00000000000000000000000000000000-00f067aa0ba902b7-01"} {
+		if _, err := goRPC.ParseTraceparent(bad); err == nil {
+			t.Fatalf("expect error for %q", bad)
+		}
+	}
+}
+
+func TestTracePropagation(t *testing.T) {
+	exporter := goRPC.NewInMemoryExporter()
+	tracer := goRPC.NewTracer(exporter)
+
+	server := goRPC.NewServer(goRPC.WithTracer(tracer))
+	var tr Trace
+	_ = server.Register(&tr)
+	l, _ := net.Listen("tcp", ":0")
+	go server.Accept(l)
+
+	client, err := goRPC.Dial("tcp", l.Addr().String(), &goRPC.Option{Tracer: tracer})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	var reply string
+	if err := client.Call(context.Background(), "Trace.Parent", TraceArgs{}, &reply); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := exporter.Spans()
+	if len(spans) != 2 {
+		t.Fatalf("expect 2 spans, got %d", len(spans))
+	}
+	var clientSpan, serverSpan goRPC.SpanData
+	for _, s := range spans {
+		if s.Kind == goRPC.SpanKindClient {
+			clientSpan = s
+		} else {
+			serverSpan = s
+		}
+	}
+	if reply != clientSpan.SpanContext.Traceparent() {
+		t.Fatalf("handler got traceparent %s, expect %s", reply, clientSpan.SpanContext.Traceparent())
+	}
+	if serverSpan.SpanContext.TraceID != clientSpan.SpanContext.TraceID || serverSpan.Parent != clientSpan.SpanContext.SpanID {
+		t.Fatal("server span is not a child of client span")
+	}
+}
+
+// GoContext异步调用同样发送追踪上下文，调用完成时结束客户端span
+func TestTracePropagationGoContext(t *testing.T) {
+	exporter := goRPC.NewInMemoryExporter()
+	tracer := goRPC.NewTracer(exporter)
+
+	server := goRPC.NewServer()
+	var tr Trace
+	_ = server.Register(&tr)
+	l, _ := net.Listen("tcp", ":0")
+	go server.Accept(l)
+	defer l.Close()
+
+	client, err := goRPC.Dial("tcp", l.Addr().String(), &goRPC.Option{Tracer: tracer})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	var reply string
+	call := <-client.GoContext(context.Background(), "Trace.Parent", TraceArgs{}, &reply, make(chan *goRPC.Call, 1)).Done
+	if call.Error != nil {
+		t.Fatal(call.Error)
+	}
+	spans := exporter.Spans()
+	if len(spans) != 1 || spans[0].Kind != goRPC.SpanKindClient {
+		t.Fatalf("expect 1 client span, got %v", spans)
+	}
+	if reply != spans[0].SpanContext.Traceparent() {
+		t.Fatalf("handler got traceparent %q, expect %s", reply, spans[0].SpanContext.Traceparent())
+	}
+
+	//Go不发送追踪上下文
+	reply = ""
+	if call := <-client.Go("Trace.Parent", TraceArgs{}, &reply, nil).Done; call.Error != nil || reply != "" {
+		t.Fatalf("expect no traceparent from Go, got %q, err %v", reply, call.Error)
+	}
+}
@@ -0,0 +1,158 @@
+package xclient
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// CallInfo 选择实例时可以使用的调用信息
+type CallInfo struct {
+	Ctx           context.Context
+	ServiceMethod string
+	Args          interface{}
+	Key           string    //一致性哈希的key，来自元数据或者HashKeyFunc，可能为空
+	Stats         LoadStats //实时负载，不会为nil
+	//实例是否可以选择（没有熔断、限流，也没有尝试过），为nil时都可以选择
+	//Balancer可以用它跳过不可用的实例，比如一致性哈希沿着环查找下一个实例
+	Available func(addr string) bool
+}
+
+// Balancer 负载均衡策略，和Discovery分离：Discovery负责维护服务列表，Balancer负责从列表中选择实例
+// 实现需要支持并发调用
+type Balancer interface {
+	Update(servers []WeightedServer)                  //服务列表变化时调用
+	Pick(info CallInfo) (string, error)               //为一次调用选择一个实例
+	Report(addr string, rtt time.Duration, err error) //一次调用的结果，调用方主动取消的调用不会上报
+}
+
+// WithBalancer 使用自定义的负载均衡策略，设置后忽略NewXClient的SelectMode
+func WithBalancer(b Balancer) XClientOption {
+	return func(xc *XClient) {
+		xc.balancer = b
+	}
+}
+
+var errNoServers = errors.New("rpc discover: no available servers")
+
+// NewBalancer 返回SelectMode对应的内置负载均衡策略，不支持的策略返回nil
+func NewBalancer(mode SelectMode) Balancer {
+	switch mode {
+	case RandomSelect:
+		return newRandomBalancer()
+	case RoundRobinSelect:
+		return newRoundRobinBalancer()
+	case ConsistentHashSelect:
+		return &consistentHashBalancer{}
+	case LeastPendingSelect:
+		return &leastPendingBalancer{r: newRand()}
+	case P2CSelect:
+		return newP2CBalancer()
+	}
+	return nil
+}
+
+func newRand() *rand.Rand {
+	return rand.New(rand.NewSource(time.Now().UnixNano()))
+}
+
+func addrs(servers []WeightedServer) []string {
+	s := make([]string, len(servers))
+	for i, server := range servers {
+		s[i] = server.Addr
+	}
+	return s
+}
+
+// weight 小于等于0时按1处理
+func weight(s WeightedServer) int {
+	if s.Weight <= 0 {
+		return 1
+	}
+	return s.Weight
+}
+
+// randomBalancer 随机选择，忽略权重
+type randomBalancer struct {
+	mu      sync.Mutex // protect following
+	r       *rand.Rand // 随机数产生
+	servers []string
+}
+
+func newRandomBalancer() *randomBalancer {
+	return &randomBalancer{r: newRand()}
+}
+
+func (b *randomBalancer) Update(servers []WeightedServer) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.servers = addrs(servers)
+}
+
+func (b *randomBalancer) Pick(CallInfo) (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.servers) == 0 {
+		return "", errNoServers
+	}
+	return b.servers[b.r.Intn(len(b.servers))], nil
+}
+
+func (b *randomBalancer) Report(string, time.Duration, error) {}
+
+// roundRobinBalancer 平滑加权轮询，权重都相同时就是普通轮询
+type roundRobinBalancer struct {
+	mu      sync.Mutex // protect following
+	servers []string
+	weights []int //和servers一一对应
+	current []int //每个实例的当前权重
+	index   int   // 记录轮询位置，权重相同时从这里开始选择
+}
+
+func newRoundRobinBalancer() *roundRobinBalancer {
+	return &roundRobinBalancer{index: newRand().Intn(math.MaxInt32 - 1)}
+}
+
+// Update 仍然存在的实例保留当前权重，避免每次更新都从头开始轮询
+func (b *roundRobinBalancer) Update(servers []WeightedServer) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	current := make(map[string]int, len(b.servers))
+	for i, addr := range b.servers {
+		current[addr] = b.current[i]
+	}
+	b.servers = addrs(servers)
+	b.weights = make([]int, len(servers))
+	b.current = make([]int, len(servers))
+	for i, s := range servers {
+		b.weights[i] = weight(s)
+		b.current[i] = current[s.Addr]
+	}
+}
+
+// Pick 平滑加权轮询（nginx）：每个实例的当前权重加上自身权重，选择当前权重最大的，
+// 再将它的当前权重减去总权重。权重为5,1,1时选择顺序为 a a b a c a a，不会连续集中到同一个实例
+func (b *roundRobinBalancer) Pick(CallInfo) (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	n := len(b.servers)
+	if n == 0 {
+		return "", errNoServers
+	}
+	total, best := 0, -1
+	for i := 0; i < n; i++ {
+		j := (b.index + i) % n //权重相同时从index开始，不同客户端的起点不同
+		b.current[j] += b.weights[j]
+		total += b.weights[j]
+		if best < 0 || b.current[j] > b.current[best] {
+			best = j
+		}
+	}
+	b.current[best] -= total
+	return b.servers[best], nil
+}
+
+func (b *roundRobinBalancer) Report(string, time.Duration, error) {}
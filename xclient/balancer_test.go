@@ -0,0 +1,189 @@
+package xclient
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRoundRobinWeighted(t *testing.T) {
+	tests := []struct {
+		weights []int
+		expect  string
+	}{
+		{[]int{5, 1, 1}, "aabacaa"},
+		{[]int{1, 1, 1}, "abcabc"},
+		{[]int{0, 2}, "babbab"}, //小于等于0按1处理
+		{[]int{3, 2}, "ababa"},
+	}
+	for _, tt := range tests {
+		servers := make([]WeightedServer, len(tt.weights))
+		for i, w := range tt.weights {
+			servers[i] = WeightedServer{Addr: string(rune('a' + i)), Weight: w}
+		}
+		b := &roundRobinBalancer{} //index为0，权重相同时从第一个开始
+		b.Update(servers)
+		var order strings.Builder
+		for i := 0; i < len(tt.expect); i++ {
+			addr, err := b.Pick(CallInfo{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			order.WriteString(addr)
+		}
+		if order.String() != tt.expect {
+			t.Errorf("weights %v: expect %s, got %s", tt.weights, tt.expect, order.String())
+		}
+	}
+}
+
+func TestNewBalancer(t *testing.T) {
+	for _, mode := range []SelectMode{RandomSelect, RoundRobinSelect, ConsistentHashSelect, LeastPendingSelect, P2CSelect} {
+		if NewBalancer(mode) == nil {
+			t.Errorf("expect balancer for mode %d", mode)
+		}
+	}
+	if b := NewBalancer(SelectMode(100)); b != nil {
+		t.Fatalf("expect nil for unknown mode, got %T", b)
+	}
+}
+
+func TestRandomBalancer(t *testing.T) {
+	b := newRandomBalancer()
+	if _, err := b.Pick(CallInfo{}); err != errNoServers {
+		t.Fatalf("expect errNoServers, got %v", err)
+	}
+	tests := [][]string{{"a"}, {"a", "b", "c"}, {"d", "e"}}
+	for _, list := range tests {
+		b.Update(servers(list...))
+		picked := make(map[string]bool)
+		for i := 0; i < 100; i++ {
+			addr, err := b.Pick(CallInfo{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			picked[addr] = true
+		}
+		for _, addr := range list {
+			if !picked[addr] {
+				t.Errorf("list %v: %s never picked", list, addr)
+			}
+			delete(picked, addr)
+		}
+		if len(picked) != 0 {
+			t.Errorf("list %v: picked servers not in list %v", list, picked)
+		}
+	}
+}
+
+// recordingBalancer 记录XClient调用Update和Report的自定义Balancer
+type recordingBalancer struct {
+	mu      sync.Mutex
+	updates [][]WeightedServer
+	reports []string
+}
+
+func (b *recordingBalancer) Update(servers []WeightedServer) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.updates = append(b.updates, servers)
+}
+
+func (b *recordingBalancer) Pick(CallInfo) (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	servers := b.updates[len(b.updates)-1]
+	return servers[0].Addr, nil
+}
+
+func (b *recordingBalancer) Report(addr string, _ time.Duration, _ error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.reports = append(b.reports, addr)
+}
+
+func (b *recordingBalancer) counts() (int, int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.updates), len(b.reports)
+}
+
+func TestCustomBalancer(t *testing.T) {
+	addr, _ := startServer(t, &Foo{})
+	b := &recordingBalancer{}
+	d := NewWeightedDiscovery([]WeightedServer{{Addr: addr, Weight: 2}})
+	xc := NewXClient(d, SelectMode(100), nil, WithBalancer(b)) //设置Balancer后忽略SelectMode
+	defer xc.Close()
+
+	var reply int
+	for i := 0; i < 3; i++ {
+		if err := xc.Call(context.Background(), "Foo.Sum", &Args{Num1: 1, Num2: 2}, &reply); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if updates, reports := b.counts(); updates != 1 || reports != 3 {
+		t.Fatalf("expect 1 update and 3 reports, got %d updates and %d reports", updates, reports)
+	}
+	if got := b.updates[0]; len(got) != 1 || got[0] != (WeightedServer{Addr: addr, Weight: 2}) {
+		t.Fatalf("expect weighted server list, got %v", got)
+	}
+
+	//列表不变时不再Update，变化后下一次调用Update
+	_ = d.UpdateWeighted([]WeightedServer{{Addr: addr, Weight: 2}})
+	_ = xc.Call(context.Background(), "Foo.Sum", &Args{Num1: 1, Num2: 2}, &reply)
+	_ = d.UpdateWeighted([]WeightedServer{{Addr: addr, Weight: 3}})
+	_ = xc.Call(context.Background(), "Foo.Sum", &Args{Num1: 1, Num2: 2}, &reply)
+	if updates, _ := b.counts(); updates != 2 {
+		t.Fatalf("expect 2 updates after the list changed, got %d", updates)
+	}
+}
+
+// countingDiscovery 记录获取整个服务列表的次数
+type countingDiscovery struct {
+	*MultiServersDiscovery
+	mu      sync.Mutex
+	fetches int
+}
+
+func (d *countingDiscovery) GetAllWeighted() ([]WeightedServer, error) {
+	d.mu.Lock()
+	d.fetches++
+	d.mu.Unlock()
+	return d.MultiServersDiscovery.GetAllWeighted()
+}
+
+func TestSyncServersVersion(t *testing.T) {
+	d := &countingDiscovery{MultiServersDiscovery: NewMultiServersDiscovery([]string{"a", "b"})}
+	xc := NewXClient(d, RandomSelect, nil)
+	defer xc.Close()
+
+	tests := []struct {
+		name   string
+		update []string //为nil时不更新列表
+		fetch  int      //累计获取列表的次数
+	}{
+		{name: "first sync", fetch: 1},
+		{name: "unchanged", fetch: 1},
+		{name: "same list", update: []string{"a", "b"}, fetch: 1},
+		{name: "changed", update: []string{"a", "c"}, fetch: 2},
+		{name: "unchanged after change", fetch: 2},
+	}
+	for _, tt := range tests {
+		if tt.update != nil {
+			_ = d.Update(tt.update)
+		}
+		for i := 0; i < 3; i++ {
+			if err := xc.syncServers(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if d.fetches != tt.fetch {
+			t.Fatalf("%s: expect %d fetches, got %d", tt.name, tt.fetch, d.fetches)
+		}
+	}
+	if addr, _ := xc.balancer.Pick(CallInfo{}); addr != "a" && addr != "c" {
+		t.Fatalf("expect balancer updated to [a c], got %s", addr)
+	}
+}
@@ -0,0 +1,247 @@
+package xclient
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	goRPC "github.com/wjh791072385/gorpc"
+)
+
+// BreakerState 熔断器状态
+type BreakerState int
+
+const (
+	BreakerClosed   BreakerState = iota //正常放行
+	BreakerOpen                         //熔断，冷却期间不再向该地址发送请求
+	BreakerHalfOpen                     //冷却结束，放行少量探测请求，成功则恢复，失败则重新熔断
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	default:
+		return "half-open"
+	}
+}
+
+// BreakerPolicy 每个地址一个熔断器，连续失败次数或者窗口内的错误率超过阈值时熔断
+type BreakerPolicy struct {
+	ConsecutiveFailures int           //连续失败多少次熔断，默认5
+	ErrorRate           float64       //窗口内错误率超过该值熔断，默认0.5
+	MinRequests         int           //窗口内请求数少于该值时不按错误率熔断，默认20
+	Window              time.Duration //统计错误率的窗口，默认10秒
+	Cooldown            time.Duration //熔断持续的时间，默认5秒
+	HalfOpenRequests    int           //半开状态允许的探测请求数，默认1
+}
+
+// WithCircuitBreaker 开启按地址熔断，熔断的地址在选择时会被跳过
+func WithCircuitBreaker(p BreakerPolicy) XClientOption {
+	return func(xc *XClient) {
+		if p.ConsecutiveFailures <= 0 {
+			p.ConsecutiveFailures = 5
+		}
+		if p.ErrorRate <= 0 {
+			p.ErrorRate = 0.5
+		}
+		if p.MinRequests <= 0 {
+			p.MinRequests = 20
+		}
+		if p.Window <= 0 {
+			p.Window = 10 * time.Second
+		}
+		if p.Cooldown <= 0 {
+			p.Cooldown = 5 * time.Second
+		}
+		if p.HalfOpenRequests <= 0 {
+			p.HalfOpenRequests = 1
+		}
+		xc.breakerPolicy = &p
+	}
+}
+
+// breakerResult 请求结果对熔断器的影响
+type breakerResult int
+
+const (
+	breakerSuccess breakerResult = iota
+	breakerFailure
+	breakerIgnored //被限流或者调用方主动取消，不能说明服务端是否健康
+)
+
+type breaker struct {
+	policy *BreakerPolicy
+
+	mu          sync.Mutex // protect following
+	state       BreakerState
+	openedAt    time.Time
+	windowStart time.Time
+	requests    int
+	failures    int
+	consecutive int
+	probes      int //半开状态已经放行的探测请求数
+}
+
+// stateLocked 冷却结束的熔断器转为半开
+func (b *breaker) stateLocked(now time.Time) BreakerState {
+	if b.state == BreakerOpen && now.Sub(b.openedAt) >= b.policy.Cooldown {
+		b.state = BreakerHalfOpen
+		b.probes = 0
+	}
+	return b.state
+}
+
+// ready 是否可以选择该地址，不消耗探测名额
+func (b *breaker) ready() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.stateLocked(time.Now()) {
+	case BreakerOpen:
+		return false
+	case BreakerHalfOpen:
+		return b.probes < b.policy.HalfOpenRequests
+	}
+	return true
+}
+
+// allow 发送请求前调用，半开状态会消耗一个探测名额
+func (b *breaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.stateLocked(time.Now()) {
+	case BreakerOpen:
+		return false
+	case BreakerHalfOpen:
+		if b.probes >= b.policy.HalfOpenRequests {
+			return false
+		}
+		b.probes++
+	}
+	return true
+}
+
+// report 记录请求结果，返回状态是否发生变化
+func (b *breaker) report(result breakerResult) (BreakerState, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	old := b.stateLocked(now)
+	failed := result == breakerFailure
+
+	if result == breakerIgnored {
+		if old == BreakerHalfOpen && b.probes > 0 {
+			b.probes-- //归还探测名额
+		}
+		return old, false
+	}
+	if old == BreakerHalfOpen {
+		if failed {
+			b.trip(now)
+		} else {
+			b.reset(now)
+		}
+		return b.state, b.state != old
+	}
+	if old == BreakerOpen {
+		return old, false //熔断之前发出的请求
+	}
+
+	if now.Sub(b.windowStart) > b.policy.Window {
+		b.windowStart, b.requests, b.failures = now, 0, 0
+	}
+	b.requests++
+	if !failed {
+		b.consecutive = 0
+		return old, false
+	}
+	b.failures++
+	b.consecutive++
+	if b.consecutive >= b.policy.ConsecutiveFailures ||
+		(b.requests >= b.policy.MinRequests && float64(b.failures)/float64(b.requests) >= b.policy.ErrorRate) {
+		b.trip(now)
+	}
+	return b.state, b.state != old
+}
+
+func (b *breaker) trip(now time.Time) {
+	b.state = BreakerOpen
+	b.openedAt = now
+}
+
+func (b *breaker) reset(now time.Time) {
+	b.state = BreakerClosed
+	b.windowStart, b.requests, b.failures, b.consecutive = now, 0, 0, 0
+}
+
+// classify 只有连接错误、Unavailable和DeadlineExceeded说明节点有问题
+// 服务端返回的其他错误，比如handler返回的业务错误、服务不存在，说明服务端可以正常响应，算作成功
+func classify(ctx context.Context, err error) breakerResult {
+	if err == nil {
+		return breakerSuccess
+	}
+	if errors.Is(ctx.Err(), context.Canceled) {
+		return breakerIgnored
+	}
+	var e *goRPC.Error
+	if !errors.As(err, &e) {
+		return breakerFailure //没有错误码的本地错误：连接断开、客户端超时
+	}
+	switch e.Code {
+	case goRPC.CodeUnavailable, goRPC.CodeDeadlineExceeded:
+		return breakerFailure
+	case goRPC.CodeResourceExhausted:
+		return breakerIgnored
+	}
+	return breakerSuccess
+}
+
+func (xc *XClient) breakerFor(addr string) *breaker {
+	if xc.breakerPolicy == nil {
+		return nil
+	}
+	xc.breakerMu.Lock()
+	defer xc.breakerMu.Unlock()
+	b, ok := xc.breakers[addr]
+	if !ok {
+		b = &breaker{policy: xc.breakerPolicy, windowStart: time.Now()}
+		xc.breakers[addr] = b
+	}
+	return b
+}
+
+// pruneBreakers 删除已经不在服务列表中的地址的熔断器
+func (xc *XClient) pruneBreakers(alive map[string]bool) {
+	xc.breakerMu.Lock()
+	defer xc.breakerMu.Unlock()
+	for addr := range xc.breakers {
+		if !alive[addr] {
+			delete(xc.breakers, addr)
+		}
+	}
+}
+
+// BreakerState 返回地址的熔断器状态，没有开启熔断或者还没有调用过时是BreakerClosed
+func (xc *XClient) BreakerState(addr string) BreakerState {
+	xc.breakerMu.Lock()
+	b, ok := xc.breakers[addr]
+	xc.breakerMu.Unlock()
+	if !ok {
+		return BreakerClosed
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.stateLocked(time.Now())
+}
+
+func (xc *XClient) reportBreaker(ctx context.Context, addr string, b *breaker, err error) {
+	if b == nil {
+		return
+	}
+	if state, changed := b.report(classify(ctx, err)); changed {
+		xc.logger.Warn("rpc xclient: circuit breaker state changed", "addr", addr, "state", state, "err", err)
+	}
+}
@@ -0,0 +1,151 @@
+package xclient
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	goRPC "github.com/wjh791072385/gorpc"
+)
+
+func TestBreakerStateMachine(t *testing.T) {
+	cooldown := 50 * time.Millisecond
+	b := &breaker{
+		policy:      &BreakerPolicy{ConsecutiveFailures: 2, ErrorRate: 1, MinRequests: 100, Window: time.Minute, Cooldown: cooldown, HalfOpenRequests: 1},
+		windowStart: time.Now(),
+	}
+	steps := []struct {
+		name   string
+		do     func()
+		allow  bool
+		expect BreakerState
+	}{
+		{"one failure", func() { b.report(breakerFailure) }, true, BreakerClosed},
+		{"success resets consecutive", func() { b.report(breakerSuccess) }, true, BreakerClosed},
+		{"failure", func() { b.report(breakerFailure) }, true, BreakerClosed},
+		{"consecutive failures trip", func() { b.report(breakerFailure) }, false, BreakerOpen},
+		{"cooldown", func() { time.Sleep(cooldown) }, true, BreakerHalfOpen},
+		{"ignored result returns the probe", func() { b.report(breakerIgnored) }, true, BreakerHalfOpen},
+		{"probe failed", func() { b.report(breakerFailure) }, false, BreakerOpen},
+		{"cooldown again", func() { time.Sleep(cooldown) }, true, BreakerHalfOpen},
+		{"probe succeeded", func() { b.report(breakerSuccess) }, true, BreakerClosed},
+	}
+	for _, s := range steps {
+		s.do()
+		b.mu.Lock()
+		state := b.stateLocked(time.Now())
+		b.mu.Unlock()
+		if state != s.expect {
+			t.Fatalf("%s: expect %s, got %s", s.name, s.expect, state)
+		}
+		//allow在半开状态会消耗探测名额，之后的一步会归还或者用掉它
+		if got := b.allow(); got != s.allow {
+			t.Fatalf("%s: expect allow %v, got %v", s.name, s.allow, got)
+		}
+	}
+}
+
+func TestBreakerErrorRate(t *testing.T) {
+	b := &breaker{
+		policy:      &BreakerPolicy{ConsecutiveFailures: 100, ErrorRate: 0.5, MinRequests: 4, Window: time.Minute, Cooldown: time.Minute, HalfOpenRequests: 1},
+		windowStart: time.Now(),
+	}
+	results := []breakerResult{breakerSuccess, breakerFailure, breakerSuccess, breakerFailure}
+	for i, r := range results {
+		state, _ := b.report(r)
+		if expect := i == len(results)-1; (state == BreakerOpen) != expect {
+			t.Fatalf("request %d: unexpected state %s", i+1, state)
+		}
+	}
+}
+
+func TestClassify(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	tests := []struct {
+		ctx    context.Context
+		err    error
+		expect breakerResult
+	}{
+		{context.Background(), nil, breakerSuccess},
+		{context.Background(), &goRPC.Error{Code: goRPC.CodeNotFound}, breakerSuccess},
+		{context.Background(), &goRPC.Error{Code: goRPC.CodeResourceExhausted}, breakerIgnored},
+		{context.Background(), &goRPC.Error{Code: goRPC.CodeUnavailable}, breakerFailure},
+		{context.Background(), &goRPC.Error{Code: goRPC.CodeDeadlineExceeded}, breakerFailure},
+		{context.Background(), &goRPC.Error{Code: goRPC.CodeUnknown, Message: "user not found"}, breakerSuccess}, //handler返回的业务错误
+		{context.Background(), goRPC.ErrShutdown, breakerFailure},                                                //连接已经断开
+		{canceled, &goRPC.Error{Code: goRPC.CodeUnavailable}, breakerIgnored},
+	}
+	for i, tt := range tests {
+		if got := classify(tt.ctx, tt.err); got != tt.expect {
+			t.Errorf("case %d: expect %d, got %d", i, tt.expect, got)
+		}
+	}
+}
+
+// handler返回的业务错误不会让健康的节点熔断
+func TestBreakerIgnoresBusinessErrors(t *testing.T) {
+	addr, _ := startServer(t, &Foo{})
+	xc := NewXClient(NewMultiServersDiscovery([]string{addr}), RandomSelect, nil,
+		WithCircuitBreaker(BreakerPolicy{ConsecutiveFailures: 2}))
+	defer xc.Close()
+
+	var reply int
+	for i := 0; i < 5; i++ {
+		if err := xc.Call(context.Background(), "Foo.Fail", Args{}, &reply); err == nil || err.Error() != "user not found" {
+			t.Fatalf("expect business error, got %v", err)
+		}
+	}
+	if state := xc.BreakerState(addr); state != BreakerClosed {
+		t.Fatalf("expect breaker closed, got %s", state)
+	}
+}
+
+// fixedBalancer 总是选择同一个地址
+type fixedBalancer struct{ addr string }
+
+func (b fixedBalancer) Update([]WeightedServer)             {}
+func (b fixedBalancer) Pick(CallInfo) (string, error)       { return b.addr, nil }
+func (b fixedBalancer) Report(string, time.Duration, error) {}
+
+// 第一次选择时也会跳过熔断的地址
+func TestPickSkipsOpenBreaker(t *testing.T) {
+	a, b := "127.0.0.1:1", "127.0.0.1:2"
+	xc := NewXClient(NewMultiServersDiscovery([]string{a, b}), RandomSelect, nil,
+		WithBalancer(fixedBalancer{a}), WithCircuitBreaker(BreakerPolicy{ConsecutiveFailures: 1}))
+	defer xc.Close()
+
+	xc.breakerFor(a).report(breakerFailure)
+	if xc.BreakerState(a) != BreakerOpen {
+		t.Fatalf("expect %s open", a)
+	}
+	addr, err := xc.pick(context.Background(), "Foo.Sum", nil, nil)
+	if err != nil || addr != b {
+		t.Fatalf("expect %s, got %s %v", b, addr, err)
+	}
+}
+
+// 服务列表变化时删除下线地址的熔断器
+func TestPruneBreakers(t *testing.T) {
+	addr1, _ := startServer(t, &Foo{})
+	addr2, _ := startServer(t, &Foo{})
+	d := NewMultiServersDiscovery([]string{addr1, addr2})
+	xc := NewXClient(d, RoundRobinSelect, nil, WithCircuitBreaker(BreakerPolicy{}))
+	defer xc.Close()
+
+	var reply int
+	for i := 0; i < 2; i++ {
+		if err := xc.Call(context.Background(), "Foo.Sum", Args{1, 2}, &reply); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_ = d.Update([]string{addr1})
+	if err := xc.Call(context.Background(), "Foo.Sum", Args{1, 2}, &reply); err != nil {
+		t.Fatal(err)
+	}
+	xc.breakerMu.Lock()
+	defer xc.breakerMu.Unlock()
+	if _, ok := xc.breakers[addr2]; ok || len(xc.breakers) != 1 {
+		t.Fatalf("expect breaker of %s pruned, got %d breakers", addr2, len(xc.breakers))
+	}
+}
@@ -0,0 +1,117 @@
+package xclient
+
+import (
+	"context"
+	"errors"
+	"hash/crc32"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	goRPC "github.com/wjh791072385/gorpc"
+)
+
+// HashKeyMetadataKey ConsistentHashSelect优先使用该元数据作为key，通过goRPC.NewOutgoingContext设置
+const HashKeyMetadataKey = "gorpc-hash-key"
+
+// HashKeyFunc 从调用参数中提取一致性哈希的key，比如缓存分片使用的用户ID
+type HashKeyFunc func(serviceMethod string, args interface{}) string
+
+// WithHashKeyFunc 元数据中没有key时，使用f从参数中提取key
+func WithHashKeyFunc(f HashKeyFunc) XClientOption {
+	return func(xc *XClient) {
+		xc.hashKey = f
+	}
+}
+
+var errNoHashKey = errors.New("rpc xclient: consistent hash select needs a key from metadata or HashKeyFunc")
+
+// defaultReplicas 每个权重单位对应的虚拟节点数，虚拟节点越多分布越均匀
+const defaultReplicas = 100
+
+// hashRing 一致性哈希环，实例变化时只有落在该实例上的key需要重新映射
+type hashRing struct {
+	keys  []uint32 //排好序的虚拟节点哈希值
+	nodes map[uint32]string
+}
+
+func newHashRing(servers []WeightedServer) *hashRing {
+	r := &hashRing{nodes: make(map[uint32]string)}
+	for _, s := range servers {
+		for j := 0; j < defaultReplicas*weight(s); j++ {
+			h := crc32.ChecksumIEEE([]byte(s.Addr + "#" + strconv.Itoa(j)))
+			if _, ok := r.nodes[h]; ok {
+				continue //极少出现的哈希冲突，保留先加入的实例
+			}
+			r.keys = append(r.keys, h)
+			r.nodes[h] = s.Addr
+		}
+	}
+	sort.Slice(r.keys, func(i, j int) bool { return r.keys[i] < r.keys[j] })
+	return r
+}
+
+// get 顺时针找到第一个可用实例的虚拟节点，available为nil时所有实例都可用
+// key所在的实例不可用时，它的key分散到环上相邻的实例，和该实例下线时的映射相同，其他key不受影响
+// 所有实例都不可用时返回key所在的实例
+func (r *hashRing) get(key string, available func(addr string) bool) string {
+	h := crc32.ChecksumIEEE([]byte(key))
+	idx := sort.Search(len(r.keys), func(i int) bool { return r.keys[i] >= h })
+	owner := r.nodes[r.keys[idx%len(r.keys)]]
+	if available == nil || available(owner) {
+		return owner
+	}
+	checked := map[string]bool{owner: true}
+	for i := 1; i < len(r.keys); i++ {
+		addr := r.nodes[r.keys[(idx+i)%len(r.keys)]]
+		if checked[addr] {
+			continue
+		}
+		if available(addr) {
+			return addr
+		}
+		checked[addr] = true
+	}
+	return owner
+}
+
+// consistentHashBalancer 一致性哈希，相同key的调用总是选择同一个实例
+type consistentHashBalancer struct {
+	mu   sync.RWMutex // protect ring
+	ring *hashRing
+}
+
+func (b *consistentHashBalancer) Update(servers []WeightedServer) {
+	ring := newHashRing(servers)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.ring = ring
+}
+
+func (b *consistentHashBalancer) Pick(info CallInfo) (string, error) {
+	if info.Key == "" {
+		return "", errNoHashKey
+	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.ring == nil || len(b.ring.keys) == 0 {
+		return "", errNoServers
+	}
+	return b.ring.get(info.Key, info.Available), nil
+}
+
+func (b *consistentHashBalancer) Report(string, time.Duration, error) {}
+
+// callKey 元数据中的key优先，其次是HashKeyFunc，都没有时返回空
+func (xc *XClient) callKey(ctx context.Context, serviceMethod string, args interface{}) string {
+	if md, ok := goRPC.OutgoingMetadata(ctx); ok {
+		if key := md.Get(HashKeyMetadataKey); key != "" {
+			return key
+		}
+	}
+	if xc.hashKey != nil {
+		return xc.hashKey(serviceMethod, args)
+	}
+	return ""
+}
@@ -0,0 +1,111 @@
+package xclient
+
+import (
+	"strconv"
+	"testing"
+)
+
+func servers(addrs ...string) []WeightedServer {
+	s := make([]WeightedServer, len(addrs))
+	for i, addr := range addrs {
+		s[i] = WeightedServer{Addr: addr, Weight: 1}
+	}
+	return s
+}
+
+func TestHashRingRemap(t *testing.T) {
+	before := newHashRing(servers("a:1", "b:1", "c:1"))
+	tests := []struct {
+		name  string
+		after []WeightedServer
+		moved string //只有这个实例上的key可以移动；为空时key只能移动到新加入的实例
+		added string
+	}{
+		{name: "remove", after: servers("a:1", "b:1"), moved: "c:1"},
+		{name: "add", after: servers("a:1", "b:1", "c:1", "d:1"), added: "d:1"},
+		{name: "same", after: servers("c:1", "b:1", "a:1")},
+	}
+	for _, tt := range tests {
+		after := newHashRing(tt.after)
+		var changed int
+		for i := 0; i < 1000; i++ {
+			key := "user-" + strconv.Itoa(i)
+			from, to := before.get(key, nil), after.get(key, nil)
+			if from == to {
+				continue
+			}
+			changed++
+			if from != tt.moved && to != tt.added {
+				t.Errorf("%s: key %s moved from %s to %s", tt.name, key, from, to)
+			}
+		}
+		if (tt.moved != "" || tt.added != "") && changed == 0 {
+			t.Errorf("%s: expect some keys to move", tt.name)
+		}
+		if tt.moved == "" && tt.added == "" && changed != 0 {
+			t.Errorf("%s: expect no keys to move, %d moved", tt.name, changed)
+		}
+	}
+}
+
+func TestHashRingWalk(t *testing.T) {
+	ring := newHashRing(servers("a:1", "b:1", "c:1"))
+	tests := []struct {
+		name        string
+		unavailable []string
+		expect      *hashRing //跳过不可用的实例后，映射和这些实例下线后的环相同
+	}{
+		{name: "all available", expect: ring},
+		{name: "skip one", unavailable: []string{"c:1"}, expect: newHashRing(servers("a:1", "b:1"))},
+		{name: "skip two", unavailable: []string{"a:1", "c:1"}, expect: newHashRing(servers("b:1"))},
+		{name: "none available", unavailable: []string{"a:1", "b:1", "c:1"}, expect: ring}, //返回key所在的实例
+	}
+	for _, tt := range tests {
+		down := make(map[string]bool)
+		for _, addr := range tt.unavailable {
+			down[addr] = true
+		}
+		available := func(addr string) bool { return !down[addr] }
+		for i := 0; i < 1000; i++ {
+			key := "user-" + strconv.Itoa(i)
+			if got, want := ring.get(key, available), tt.expect.get(key, nil); got != want {
+				t.Fatalf("%s: key %s expect %s, got %s", tt.name, key, want, got)
+			}
+		}
+	}
+}
+
+func TestConsistentHashPick(t *testing.T) {
+	b := &consistentHashBalancer{}
+	if _, err := b.Pick(CallInfo{Key: "user-1"}); err != errNoServers {
+		t.Fatalf("expect errNoServers before Update, got %v", err)
+	}
+	b.Update(servers("a:1", "b:1", "c:1"))
+	if _, err := b.Pick(CallInfo{}); err != errNoHashKey {
+		t.Fatalf("expect errNoHashKey without key, got %v", err)
+	}
+	first, _ := b.Pick(CallInfo{Key: "user-1"})
+	for i := 0; i < 10; i++ {
+		if addr, _ := b.Pick(CallInfo{Key: "user-1"}); addr != first {
+			t.Fatalf("expect the same key to pick %s, got %s", first, addr)
+		}
+	}
+	next, _ := b.Pick(CallInfo{Key: "user-1", Available: func(addr string) bool { return addr != first }})
+	if next == first {
+		t.Fatalf("expect to skip unavailable %s", first)
+	}
+}
+
+// 虚拟节点的key带分隔符，不同地址的虚拟节点不会拼出相同的key
+func TestHashRingReplicas(t *testing.T) {
+	ring := newHashRing(servers("2.0.0.1:80", "22.0.0.1:80"))
+	count := make(map[string]int)
+	for _, addr := range ring.nodes {
+		count[addr]++
+	}
+	for _, addr := range []string{"2.0.0.1:80", "22.0.0.1:80"} {
+		if count[addr] != defaultReplicas {
+			t.Errorf("expect %d virtual nodes for %s, got %d", defaultReplicas, addr, count[addr])
+		}
+	}
+}
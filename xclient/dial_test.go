@@ -0,0 +1,95 @@
+package xclient
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	goRPC "github.com/wjh791072385/gorpc"
+)
+
+// countingListener 记录接受的连接数
+type countingListener struct {
+	net.Listener
+	accepted int64
+}
+
+func (l *countingListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err == nil {
+		atomic.AddInt64(&l.accepted, 1)
+	}
+	return conn, err
+}
+
+// 同一个地址的并发调用共享同一次拨号
+func TestDialDedup(t *testing.T) {
+	inner, _ := net.Listen("tcp", "127.0.0.1:0")
+	l := &countingListener{Listener: inner}
+	server := goRPC.NewServer()
+	_ = server.Register(&Foo{})
+	go server.Accept(l)
+	defer l.Close()
+
+	xc := NewXClient(NewMultiServersDiscovery([]string{l.Addr().String()}), RandomSelect, nil)
+	defer xc.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var reply int
+			if err := xc.Call(context.Background(), "Foo.Sum", Args{1, 2}, &reply); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := atomic.LoadInt64(&l.accepted); n != 1 {
+		t.Fatalf("expect 1 connection, got %d", n)
+	}
+	if s := xc.PoolStats()[l.Addr().String()]; s.Dials != 1 {
+		t.Fatalf("expect 1 dial, got %+v", s)
+	}
+}
+
+// 拨号失败后的TTL内直接返回上次的错误，过期之后重新拨号
+func TestDialFailureCache(t *testing.T) {
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	addr := l.Addr().String()
+	_ = l.Close()
+
+	ttl := 200 * time.Millisecond
+	xc := NewXClient(NewMultiServersDiscovery([]string{addr}), RandomSelect, nil, WithDialFailureTTL(ttl), WithFailMode(Failfast))
+	defer xc.Close()
+
+	var reply int
+	err := xc.Call(context.Background(), "Foo.Sum", Args{1, 2}, &reply)
+	if err == nil || strings.Contains(err.Error(), "failed recently") {
+		t.Fatalf("expect dial error, got %v", err)
+	}
+
+	//服务端启动之后，TTL内仍然返回缓存的错误
+	l, err = net.Listen("tcp", addr)
+	if err != nil {
+		t.Skip("port reused:", err)
+	}
+	server := goRPC.NewServer()
+	_ = server.Register(&Foo{})
+	go server.Accept(l)
+	defer l.Close()
+
+	err = xc.Call(context.Background(), "Foo.Sum", Args{1, 2}, &reply)
+	if err == nil || !strings.Contains(err.Error(), "failed recently") {
+		t.Fatalf("expect cached dial error, got %v", err)
+	}
+	time.Sleep(ttl)
+	if err := xc.Call(context.Background(), "Foo.Sum", Args{1, 2}, &reply); err != nil {
+		t.Fatalf("expect redial after ttl, got %v", err)
+	}
+}
@@ -1,77 +1,168 @@
 package xclient
 
 import (
+	"context"
 	"errors"
-	"math"
-	"math/rand"
 	"sync"
-	"time"
 )
 
 type SelectMode int
 
+// SelectMode 内置的负载均衡策略，通过NewBalancer创建对应的Balancer
 const (
-	RandomSelect     SelectMode = iota //随机选择策略
-	RoundRobinSelect                   //加权轮询
+	RandomSelect         SelectMode = iota //随机选择策略
+	RoundRobinSelect                       //加权轮询，平滑加权轮询，权重都相同时就是普通轮询
+	ConsistentHashSelect                   //一致性哈希，相同key的调用总是选择同一个实例
+	LeastPendingSelect                     //选择未完成调用数最少的实例
+	P2CSelect                              //随机选两个实例，选择峰值EWMA延迟和未完成调用数综合代价更小的
 )
 
 type Discovery interface {
 	Refresh() error                      //从注册中心更新列表
 	Update(servers []string) error       //手动更新列表
-	Get(mode SelectMode) (string, error) //根据策略选择一个服务实例
+	Get(mode SelectMode) (string, error) //根据策略选择一个服务实例，XClient不使用，这里的负载均衡状态和XClient的Balancer互相独立
 	GetAll() ([]string, error)           //返回所有服务实例
 }
 
+// WeightedServer 带权重的服务实例
+type WeightedServer struct {
+	Addr   string
+	Weight int //小于等于0时按1处理
+}
+
+// WeightedDiscovery 可以返回实例权重的Discovery
+type WeightedDiscovery interface {
+	Discovery
+	UpdateWeighted(servers []WeightedServer) error
+	GetAllWeighted() ([]WeightedServer, error)
+}
+
+// VersionedDiscovery 服务列表每次变化时版本号增加，XClient先调用Refresh，版本号没变时不再获取和比较整个列表
+type VersionedDiscovery interface {
+	Discovery
+	Version() uint64
+}
+
 // MultiServersDiscovery 实现一个不需要注册中心，服务列表由手工维护的服务发现的结构体,用于测试负载均衡，模拟
 type MultiServersDiscovery struct {
-	r       *rand.Rand // 随机数产生
-	mu      sync.RWMutex
-	servers []string
-	index   int // 记录轮询位置
+	mu        sync.RWMutex
+	servers   []string
+	weights   []int                   //和servers一一对应
+	version   uint64                  //服务列表变化的次数
+	balancers map[SelectMode]Balancer //Get使用的内置负载均衡策略，第一次使用时创建，和XClient的Balancer不共享状态
 }
 
 func NewMultiServersDiscovery(servers []string) *MultiServersDiscovery {
 	d := &MultiServersDiscovery{
-		r:       rand.New(rand.NewSource(time.Now().UnixNano())),
-		servers: servers,
+		balancers: make(map[SelectMode]Balancer),
 	}
-	d.index = d.r.Intn(math.MaxInt32 - 1)
+	d.setServers(unweighted(servers))
 	return d
 }
 
-var _ Discovery = (*MultiServersDiscovery)(nil)
+// NewWeightedDiscovery 服务列表带权重，RoundRobinSelect按权重比例选择
+func NewWeightedDiscovery(servers []WeightedServer) *MultiServersDiscovery {
+	d := NewMultiServersDiscovery(nil)
+	d.setServers(servers)
+	return d
+}
+
+var (
+	_ WeightedDiscovery  = (*MultiServersDiscovery)(nil)
+	_ VersionedDiscovery = (*MultiServersDiscovery)(nil)
+)
+
+func unweighted(servers []string) []WeightedServer {
+	ws := make([]WeightedServer, len(servers))
+	for i, addr := range servers {
+		ws[i] = WeightedServer{Addr: addr, Weight: 1}
+	}
+	return ws
+}
+
+// setServers 调用方持有锁，列表变化时增加版本号，同时更新已经创建的负载均衡策略
+func (m *MultiServersDiscovery) setServers(servers []WeightedServer) {
+	if m.sameLocked(servers) {
+		return
+	}
+	m.version++
+	m.servers = make([]string, len(servers))
+	m.weights = make([]int, len(servers))
+	for i, s := range servers {
+		m.servers[i] = s.Addr
+		m.weights[i] = weight(s)
+	}
+	for _, b := range m.balancers {
+		b.Update(m.weightedLocked())
+	}
+}
+
+// sameLocked 和当前的服务列表相同，顺序不同也认为变化了
+func (m *MultiServersDiscovery) sameLocked(servers []WeightedServer) bool {
+	if m.servers == nil || len(servers) != len(m.servers) {
+		return false
+	}
+	for i, s := range servers {
+		if s.Addr != m.servers[i] || weight(s) != m.weights[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *MultiServersDiscovery) weightedLocked() []WeightedServer {
+	servers := make([]WeightedServer, len(m.servers))
+	for i, addr := range m.servers {
+		servers[i] = WeightedServer{Addr: addr, Weight: m.weights[i]}
+	}
+	return servers
+}
 
 func (m *MultiServersDiscovery) Refresh() error {
 	return nil
 }
 
 func (m *MultiServersDiscovery) Update(servers []string) error {
+	return m.UpdateWeighted(unweighted(servers))
+}
+
+// UpdateWeighted 手动更新带权重的服务列表
+func (m *MultiServersDiscovery) UpdateWeighted(servers []WeightedServer) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	m.servers = servers
+	m.setServers(servers)
 	return nil
 }
 
+// Get 使用mode对应的内置负载均衡策略选择，ConsistentHashSelect需要key，应当通过XClient调用
+// 这里的负载均衡策略属于Discovery，和XClient的Balancer互相独立，轮询位置、延迟等状态不共享
 func (m *MultiServersDiscovery) Get(mode SelectMode) (string, error) {
 	m.mu.Lock()
-	defer m.mu.Unlock()
-
-	n := len(m.servers)
-	if n == 0 {
-		return "", errors.New("rpc discover: no available servers")
+	b, ok := m.balancers[mode]
+	if !ok {
+		if b = NewBalancer(mode); b == nil {
+			m.mu.Unlock()
+			return "", errors.New("rpc discovery: not supported select mode")
+		}
+		b.Update(m.weightedLocked())
+		m.balancers[mode] = b
 	}
+	m.mu.Unlock()
+	return b.Pick(CallInfo{Ctx: context.Background(), Stats: noLoad{}})
+}
 
-	switch mode {
-	case RandomSelect:
-		return m.servers[m.r.Intn(n)], nil
-	case RoundRobinSelect:
-		//从index处开始轮询
-		s := m.servers[m.index%n]
-		m.index = (m.index + 1) % n
-		return s, nil
-	default:
-		return "", errors.New("rpc discovery: not supported select mode")
-	}
+// GetAllWeighted 返回带权重的服务列表
+func (m *MultiServersDiscovery) GetAllWeighted() ([]WeightedServer, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.weightedLocked(), nil
+}
+
+// Version 返回服务列表的版本号，RegistryDiscovery和HealthCheckDiscovery通过嵌入复用
+func (m *MultiServersDiscovery) Version() uint64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.version
 }
 
 func (m *MultiServersDiscovery) GetAll() ([]string, error) {
@@ -0,0 +1,273 @@
+package xclient
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	goRPC "github.com/wjh791072385/gorpc"
+)
+
+// HealthCheckDiscovery 包装另一个Discovery，通过 Health.Check 过滤掉不健康的实例
+// 检查在后台goroutine中每隔interval进行一次，Get和GetAll不会等待检查
+type HealthCheckDiscovery struct {
+	*MultiServersDiscovery //只保存健康的实例，复用其选择策略
+	d                      Discovery
+	service                string //检查的服务名，为空表示整个Server
+	opt                    *goRPC.Option
+	interval               time.Duration
+	logger                 goRPC.Logger
+
+	trigger   chan struct{} //Update后立即重新检查
+	ready     chan struct{} //第一次检查完成后关闭
+	done      chan struct{}
+	closeOnce sync.Once
+
+	errMu sync.Mutex // protect err
+	err   error      //还没有一次成功的检查时，最近一次检查的错误
+
+	clientsMu sync.Mutex // protect following
+	clients   map[string]*goRPC.Client
+	closed    bool
+}
+
+const (
+	defaultHealthCheckInterval = time.Second * 5
+	healthCheckTimeout         = time.Second
+)
+
+var _ VersionedDiscovery = (*HealthCheckDiscovery)(nil)
+
+var errDiscoveryClosed = errors.New("rpc discovery: health check discovery is closed")
+
+func NewHealthCheckDiscovery(d Discovery, service string, opt *goRPC.Option, interval time.Duration, opts ...DiscoveryOption) *HealthCheckDiscovery {
+	if interval == 0 {
+		interval = defaultHealthCheckInterval
+	}
+	h := &HealthCheckDiscovery{
+		MultiServersDiscovery: NewMultiServersDiscovery(make([]string, 0)),
+		d:                     d,
+		service:               service,
+		opt:                   opt,
+		interval:              interval,
+		logger:                newDiscoveryOptions(opts).logger,
+		trigger:               make(chan struct{}, 1),
+		ready:                 make(chan struct{}),
+		done:                  make(chan struct{}),
+		clients:               make(map[string]*goRPC.Client),
+	}
+	go h.run()
+	return h
+}
+
+// run 后台定期检查，Close后退出
+func (h *HealthCheckDiscovery) run() {
+	t := time.NewTicker(h.interval)
+	defer t.Stop()
+	loaded := false
+	for {
+		err := h.checkAll()
+		if err != nil {
+			h.logger.Warn("rpc discovery: health check error", "service", h.service, "err", err)
+		}
+		if err == nil || !loaded {
+			//已经有健康列表时，底层Discovery暂时出错不影响使用旧的列表
+			h.errMu.Lock()
+			h.err = err
+			h.errMu.Unlock()
+		}
+		if !loaded {
+			close(h.ready)
+		}
+		loaded = loaded || err == nil
+
+		select {
+		case <-t.C:
+		case <-h.trigger:
+		case <-h.done:
+			return
+		}
+	}
+}
+
+// checkAll 检查底层Discovery中的所有实例，只保留健康的
+func (h *HealthCheckDiscovery) checkAll() error {
+	servers, err := h.servers()
+	if err != nil {
+		return err
+	}
+
+	healthy := make([]bool, len(servers))
+	var wg sync.WaitGroup
+	for i, addr := range servers {
+		wg.Add(1)
+		go func(i int, addr string) {
+			defer wg.Done()
+			healthy[i] = h.check(addr)
+		}(i, addr.Addr)
+	}
+	wg.Wait()
+
+	alive := make([]WeightedServer, 0, len(servers))
+	addrs := make([]string, len(servers))
+	for i, s := range servers {
+		addrs[i] = s.Addr
+		if healthy[i] {
+			alive = append(alive, s)
+		} else {
+			h.logger.Warn("rpc discovery: skip unhealthy server", "addr", s.Addr, "service", h.service)
+		}
+	}
+	h.pruneClients(addrs)
+	return h.MultiServersDiscovery.UpdateWeighted(alive)
+}
+
+// Refresh 只等待第一次检查完成，之后由后台goroutine定期检查
+func (h *HealthCheckDiscovery) Refresh() error {
+	select {
+	case <-h.done:
+		return errDiscoveryClosed
+	default:
+	}
+	select {
+	case <-h.ready:
+	case <-h.done:
+		return errDiscoveryClosed
+	}
+	h.errMu.Lock()
+	defer h.errMu.Unlock()
+	return h.err
+}
+
+// recheck 通知后台goroutine立即检查，已经有等待中的通知时直接返回
+func (h *HealthCheckDiscovery) recheck() {
+	select {
+	case h.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// servers 底层Discovery支持权重时保留权重
+func (h *HealthCheckDiscovery) servers() ([]WeightedServer, error) {
+	if wd, ok := h.d.(WeightedDiscovery); ok {
+		return wd.GetAllWeighted()
+	}
+	addrs, err := h.d.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	return unweighted(addrs), nil
+}
+
+// check 只有SERVING才认为是健康的，连接失败也认为不健康
+func (h *HealthCheckDiscovery) check(addr string) bool {
+	client, err := h.client(addr)
+	if err != nil {
+		return false
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), healthCheckTimeout)
+	defer cancel()
+	var reply goRPC.HealthCheckResponse
+	err = client.Call(ctx, goRPC.HealthServiceName+".Check", goRPC.HealthCheckRequest{Service: h.service}, &reply)
+	return err == nil && reply.Status == goRPC.HealthServing
+}
+
+// client 复用检查用的连接，拨号时不持有锁，不同地址互不影响
+func (h *HealthCheckDiscovery) client(addr string) (*goRPC.Client, error) {
+	h.clientsMu.Lock()
+	client, ok := h.clients[addr]
+	h.clientsMu.Unlock()
+	if ok && client.IsAvailable() {
+		return client, nil
+	}
+
+	client, err := goRPC.Dial("tcp", addr, h.opt)
+	if err != nil {
+		return nil, err
+	}
+	h.clientsMu.Lock()
+	defer h.clientsMu.Unlock()
+	if h.closed {
+		_ = client.Close()
+		return nil, errDiscoveryClosed
+	}
+	if old, ok := h.clients[addr]; ok {
+		_ = old.Close()
+	}
+	h.clients[addr] = client
+	return client, nil
+}
+
+// pruneClients 关闭已经不在服务列表中的连接
+func (h *HealthCheckDiscovery) pruneClients(servers []string) {
+	keep := make(map[string]bool, len(servers))
+	for _, addr := range servers {
+		keep[addr] = true
+	}
+	h.clientsMu.Lock()
+	defer h.clientsMu.Unlock()
+	for addr, client := range h.clients {
+		if !keep[addr] {
+			_ = client.Close()
+			delete(h.clients, addr)
+		}
+	}
+}
+
+// Close 停止后台检查，关闭健康检查使用的连接
+func (h *HealthCheckDiscovery) Close() error {
+	h.closeOnce.Do(func() { close(h.done) })
+	h.clientsMu.Lock()
+	h.closed = true
+	h.clientsMu.Unlock()
+	h.pruneClients(nil)
+	return nil
+}
+
+// Update 手动更新底层Discovery，后台立即重新检查
+func (h *HealthCheckDiscovery) Update(servers []string) error {
+	if err := h.d.Update(servers); err != nil {
+		return err
+	}
+	h.recheck()
+	return nil
+}
+
+// UpdateWeighted 底层Discovery支持权重时更新带权重的列表，后台立即重新检查
+func (h *HealthCheckDiscovery) UpdateWeighted(servers []WeightedServer) error {
+	wd, ok := h.d.(WeightedDiscovery)
+	if !ok {
+		addrs := make([]string, len(servers))
+		for i, s := range servers {
+			addrs[i] = s.Addr
+		}
+		return h.Update(addrs)
+	}
+	if err := wd.UpdateWeighted(servers); err != nil {
+		return err
+	}
+	h.recheck()
+	return nil
+}
+
+func (h *HealthCheckDiscovery) GetAllWeighted() ([]WeightedServer, error) {
+	if err := h.Refresh(); err != nil {
+		return nil, err
+	}
+	return h.MultiServersDiscovery.GetAllWeighted()
+}
+
+func (h *HealthCheckDiscovery) Get(mode SelectMode) (string, error) {
+	if err := h.Refresh(); err != nil {
+		return "", err
+	}
+	return h.MultiServersDiscovery.Get(mode)
+}
+
+func (h *HealthCheckDiscovery) GetAll() ([]string, error) {
+	if err := h.Refresh(); err != nil {
+		return nil, err
+	}
+	return h.MultiServersDiscovery.GetAll()
+}
@@ -0,0 +1,117 @@
+package xclient
+
+import (
+	"bytes"
+	"log"
+	"net"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	goRPC "github.com/wjh791072385/gorpc"
+)
+
+// syncBuffer 后台goroutine写日志时并发安全
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestHealthCheckDiscovery(t *testing.T) {
+	healthy, _ := startServer(t, &Foo{})
+	sick, server := startServer(t, &Foo{})
+	server.SetServingStatus("Foo", goRPC.HealthNotServing)
+
+	var buf syncBuffer
+	logger := goRPC.NewStdLogger(log.New(&buf, "", 0), goRPC.LevelInfo)
+	d := NewHealthCheckDiscovery(NewMultiServersDiscovery([]string{healthy, sick}), "Foo", nil, time.Hour, WithDiscoveryLogger(logger))
+	defer d.Close()
+
+	servers, err := d.GetAll()
+	if err != nil || !reflect.DeepEqual(servers, []string{healthy}) {
+		t.Fatalf("expect only healthy server, got %v %v", servers, err)
+	}
+	if !strings.Contains(buf.String(), "skip unhealthy server addr="+sick) {
+		t.Fatalf("expect unhealthy server logged by custom logger, got %q", buf.String())
+	}
+
+	//Update后后台立即重新检查
+	server.SetServingStatus("Foo", goRPC.HealthServing)
+	_ = d.Update([]string{healthy, sick})
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		servers, _ = d.GetAll()
+		if len(servers) == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expect recovered server after update, got %v", servers)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestHealthCheckDiscoveryNotBlocking(t *testing.T) {
+	healthy, _ := startServer(t, &Foo{})
+	//接受连接但从不响应，每次检查都要等到healthCheckTimeout
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	defer l.Close()
+	go func() {
+		var conns []net.Conn
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				for _, c := range conns {
+					_ = c.Close()
+				}
+				return
+			}
+			conns = append(conns, conn)
+		}
+	}()
+	hang := l.Addr().String()
+
+	d := NewHealthCheckDiscovery(NewMultiServersDiscovery([]string{healthy, hang}), "", nil, time.Hour)
+	defer d.Close()
+	if _, err := d.Get(RandomSelect); err != nil { //等待第一次检查
+		t.Fatal(err)
+	}
+
+	_ = d.Update([]string{healthy, hang})
+	time.Sleep(50 * time.Millisecond) //后台检查正在等待hang
+	start := time.Now()
+	for i := 0; i < 10; i++ {
+		if addr, err := d.Get(RandomSelect); err != nil || addr != healthy {
+			t.Fatalf("expect %s, got %s %v", healthy, addr, err)
+		}
+	}
+	if cost := time.Since(start); cost > healthCheckTimeout/2 {
+		t.Fatalf("Get blocked by background health check for %s", cost)
+	}
+}
+
+func TestHealthCheckDiscoveryClose(t *testing.T) {
+	addr, _ := startServer(t, &Foo{})
+	d := NewHealthCheckDiscovery(NewMultiServersDiscovery([]string{addr}), "", nil, time.Hour)
+	if _, err := d.GetAll(); err != nil {
+		t.Fatal(err)
+	}
+	_ = d.Close()
+	if _, err := d.GetAll(); err != errDiscoveryClosed {
+		t.Fatalf("expect %v, got %v", errDiscoveryClosed, err)
+	}
+}
@@ -2,10 +2,13 @@ package xclient
 
 import (
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
-	"log"
 	"net/http"
 	"time"
+
+	goRPC "github.com/wjh791072385/gorpc"
+	"github.com/wjh791072385/gorpc/registry"
 )
 
 // RegistryDiscovery 用于注册中心的服务发现
@@ -14,11 +17,36 @@ type RegistryDiscovery struct {
 	registry               string //注册中心地址
 	timeout                time.Duration
 	lastUpdate             time.Time //表示注册中心最后的更新时间，如果距离当前时间超过了timeout，那么就要重新获取服务列表
+	logger                 goRPC.Logger
+}
+
+// DiscoveryOption RegistryDiscovery和HealthCheckDiscovery的可选配置
+type DiscoveryOption func(*discoveryOptions)
+
+type discoveryOptions struct {
+	logger goRPC.Logger
+}
+
+// WithDiscoveryLogger 设置服务发现的日志，默认使用goRPC.DefaultLogger
+func WithDiscoveryLogger(logger goRPC.Logger) DiscoveryOption {
+	return func(o *discoveryOptions) {
+		o.logger = logger
+	}
+}
+
+func newDiscoveryOptions(opts []DiscoveryOption) *discoveryOptions {
+	o := &discoveryOptions{logger: goRPC.DefaultLogger}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
 }
 
 const defaultUpdateTimeout = time.Second * 10
 
-func NewGeeRegistryDiscovery(registerAddr string, timeout time.Duration) *RegistryDiscovery {
+var _ VersionedDiscovery = (*RegistryDiscovery)(nil)
+
+func NewGeeRegistryDiscovery(registerAddr string, timeout time.Duration, opts ...DiscoveryOption) *RegistryDiscovery {
 	if timeout == 0 {
 		timeout = defaultUpdateTimeout
 	}
@@ -26,16 +54,22 @@ func NewGeeRegistryDiscovery(registerAddr string, timeout time.Duration) *Regist
 		MultiServersDiscovery: NewMultiServersDiscovery(make([]string, 0)),
 		registry:              registerAddr,
 		timeout:               timeout,
+		logger:                newDiscoveryOptions(opts).logger,
 	}
 	return d
 }
 
 // Update 手动更新
 func (r *RegistryDiscovery) Update(servers []string) error {
+	return r.UpdateWeighted(unweighted(servers))
+}
+
+// UpdateWeighted 手动更新带权重的服务列表
+func (r *RegistryDiscovery) UpdateWeighted(servers []WeightedServer) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 	//更新的是RegistryDiscovery的匿名结构体中的servers字段
-	r.servers = servers
+	r.setServers(servers)
 	r.lastUpdate = time.Now()
 	return nil
 }
@@ -48,23 +82,52 @@ func (r *RegistryDiscovery) Refresh() error {
 		//表示还不用更新
 		return nil
 	}
-	log.Println("rpc registry: refresh servers from registry", r.registry)
+	r.logger.Debug("rpc registry: refresh servers from registry", "registry", r.registry)
 
-	//通过Http的get方法返回当前所有可用的服务
-	resp, err := http.Get(r.registry)
+	//通过Http的get方法返回当前所有可用的服务，请求头要求注册中心同时返回权重
+	req, _ := http.NewRequest("GET", r.registry, nil)
+	req.Header.Set(registry.WeightedHeader, "1")
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		log.Println("rpc registry refresh err:", err)
+		r.logger.Warn("rpc registry: refresh error", "registry", r.registry, "err", err)
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		err = fmt.Errorf("rpc registry: refresh from %s: unexpected status %s", r.registry, resp.Status)
+		r.logger.Warn("rpc registry: refresh error", "registry", r.registry, "err", err)
 		return err
 	}
 	data, err := ioutil.ReadAll(resp.Body)
-	servers := make([]string, 0)
-	json.Unmarshal(data, &servers)
+	if err != nil {
+		return err
+	}
+
+	//旧版本的注册中心只返回地址列表，两种格式都解析失败时保留原来的服务列表
+	servers, err := decodeServers(data)
+	if err != nil {
+		r.logger.Warn("rpc registry: decode servers error", "registry", r.registry, "err", err)
+		return err
+	}
 
-	r.servers = servers
+	r.setServers(servers)
 	r.lastUpdate = time.Now()
 	return nil
 }
 
+func decodeServers(data []byte) ([]WeightedServer, error) {
+	servers := make([]WeightedServer, 0)
+	err := json.Unmarshal(data, &servers)
+	if err == nil {
+		return servers, nil
+	}
+	addrs := make([]string, 0)
+	if json.Unmarshal(data, &addrs) != nil {
+		return nil, err
+	}
+	return unweighted(addrs), nil
+}
+
 // Get 根据负载均衡策略来做选择
 func (r *RegistryDiscovery) Get(mode SelectMode) (string, error) {
 	//先进行更新
@@ -74,6 +137,13 @@ func (r *RegistryDiscovery) Get(mode SelectMode) (string, error) {
 	return r.MultiServersDiscovery.Get(mode)
 }
 
+func (r *RegistryDiscovery) GetAllWeighted() ([]WeightedServer, error) {
+	if err := r.Refresh(); err != nil {
+		return nil, err
+	}
+	return r.MultiServersDiscovery.GetAllWeighted()
+}
+
 func (r *RegistryDiscovery) GetAll() ([]string, error) {
 	if err := r.Refresh(); err != nil {
 		return nil, err
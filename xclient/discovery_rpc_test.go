@@ -0,0 +1,69 @@
+package xclient
+
+import (
+	"bytes"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	goRPC "github.com/wjh791072385/gorpc"
+	"github.com/wjh791072385/gorpc/registry"
+)
+
+func TestRegistryDiscoveryLogger(t *testing.T) {
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	addr := l.Addr().String()
+	_ = l.Close() //注册中心不可用
+
+	var buf bytes.Buffer
+	logger := goRPC.NewStdLogger(log.New(&buf, "", 0), goRPC.LevelInfo)
+	d := NewGeeRegistryDiscovery("http://"+addr+"/gorpc/registry", 0, WithDiscoveryLogger(logger))
+	if err := d.Refresh(); err == nil {
+		t.Fatal("expect refresh error")
+	}
+	if !strings.Contains(buf.String(), "WARN rpc registry: refresh error") {
+		t.Fatalf("expect refresh error logged by custom logger, got %q", buf.String())
+	}
+}
+
+func TestRegistryDiscoveryRefresh(t *testing.T) {
+	old := []WeightedServer{{Addr: "127.0.0.1:1", Weight: 1}}
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		expect  []WeightedServer
+		wantErr bool
+	}{
+		{"weighted", http.StatusOK, `[{"Addr":"127.0.0.1:2","Weight":3}]`, []WeightedServer{{Addr: "127.0.0.1:2", Weight: 3}}, false},
+		{"addresses only", http.StatusOK, `["127.0.0.1:2"]`, []WeightedServer{{Addr: "127.0.0.1:2", Weight: 1}}, false},
+		{"bad status keeps servers", http.StatusInternalServerError, `[]`, old, true},
+		{"bad body keeps servers", http.StatusOK, `not json`, old, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				if req.Header.Get(registry.WeightedHeader) == "" {
+					t.Errorf("expect %s header", registry.WeightedHeader)
+				}
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			defer ts.Close()
+
+			d := NewGeeRegistryDiscovery(ts.URL, 0)
+			d.setServers(old)
+			if err := d.Refresh(); (err != nil) != tt.wantErr {
+				t.Fatalf("expect error %v, got %v", tt.wantErr, err)
+			}
+			servers, _ := d.MultiServersDiscovery.GetAllWeighted()
+			if !reflect.DeepEqual(servers, tt.expect) {
+				t.Fatalf("expect %v, got %v", tt.expect, servers)
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package xclient
+
+import (
+	"context"
+	"reflect"
+	"time"
+)
+
+// FailMode 调用失败时的处理方式
+type FailMode int
+
+const (
+	Failfast   FailMode = iota //失败立即返回，忽略重试策略，默认
+	Failover                   //失败后按重试策略选择其他节点重试
+	Failtry                    //失败后按重试策略在同一个节点重试
+	Failbackup                 //第一个节点超过BackupLatency没有响应时，向另一个节点发送相同的请求，使用先成功的结果
+)
+
+func (m FailMode) String() string {
+	switch m {
+	case Failfast:
+		return "Failfast"
+	case Failover:
+		return "Failover"
+	case Failtry:
+		return "Failtry"
+	default:
+		return "Failbackup"
+	}
+}
+
+const defaultBackupLatency = 10 * time.Millisecond
+
+// WithFailMode 设置失败处理方式，默认Failfast，只选择一次节点并返回它的错误
+// Failover和Failtry没有设置WithRetryPolicy时按DefaultRetryPolicy重试
+func WithFailMode(mode FailMode) XClientOption {
+	return func(xc *XClient) {
+		xc.failMode = mode
+	}
+}
+
+// WithBackupLatency Failbackup模式下发送备份请求前等待的时间，默认10ms
+func WithBackupLatency(d time.Duration) XClientOption {
+	return func(xc *XClient) {
+		xc.backupLatency = d
+	}
+}
+
+type backupResult struct {
+	addr  string
+	reply interface{}
+	err   error
+}
+
+// callBackup 先向primary发送请求，超过delay没有返回或者失败时再向另一个节点发送，
+// 使用先成功的结果并取消另一个请求，tried记录两个请求使用的地址
+// h不为nil时用于对冲请求：delay小于等于0表示不对冲，对冲受比例上限限制，第一个请求失败时直接返回，由调用方按FailMode处理
+func (xc *XClient) callBackup(ctx context.Context, primary string, attempt int, tried map[string]bool, serviceMethod string, args, reply interface{}, delay time.Duration, h *hedger) error {
+	tried[primary] = true
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel() //返回时取消还没有完成的请求
+	var err error
+	results := make(chan backupResult, 2)
+	launch := func(attempt int, addr string) {
+		//两个请求并发解码，各自使用独立的reply
+		var clonedReply interface{}
+		if reply != nil {
+			clonedReply = reflect.New(reflect.ValueOf(reply).Elem().Type()).Interface()
+		}
+		go func() {
+			err := xc.attempt(ctx, addr, attempt, serviceMethod, args, clonedReply)
+			results <- backupResult{addr: addr, reply: clonedReply, err: err}
+		}()
+	}
+	launch(attempt, primary)
+
+	var timeout <-chan time.Time
+	if delay > 0 {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	running, backupSent := 1, false
+	sendBackup := func() {
+		backupSent = true
+		//所有地址都尝试过时pick会返回尝试过的地址，不向同一个节点重复发送
+		addr, err := xc.pick(ctx, serviceMethod, args, tried)
+		if err != nil || tried[addr] {
+			return
+		}
+		tried[addr] = true
+		xc.logger.Debug("rpc xclient: send backup request", "method", serviceMethod, "primary", primary, "backup", addr)
+		launch(attempt, addr)
+		running++
+	}
+
+	for {
+		select {
+		case r := <-results:
+			running--
+			if r.err == nil {
+				if reply != nil {
+					reflect.ValueOf(reply).Elem().Set(reflect.ValueOf(r.reply).Elem())
+				}
+				return nil
+			}
+			err = r.err
+			//第一个请求提前失败时立即发送备份请求
+			if !backupSent && h == nil && ctx.Err() == nil {
+				sendBackup()
+			}
+			if running == 0 {
+				return err
+			}
+		case <-timeout:
+			if !backupSent && (h == nil || h.allow()) {
+				sendBackup()
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package xclient
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// 不可用的地址权重更大，第一次总是选中它
+func deadFirst(t *testing.T, live string) *MultiServersDiscovery {
+	return NewWeightedDiscovery([]WeightedServer{{Addr: deadAddr(t), Weight: 2}, {Addr: live, Weight: 1}})
+}
+
+// 默认Failfast，只选择一次节点，不重试
+func TestDefaultFailMode(t *testing.T) {
+	foo := &Foo{}
+	addr, _ := startServer(t, foo)
+	xc := NewXClient(deadFirst(t, addr), RoundRobinSelect, nil)
+	defer xc.Close()
+
+	var reply int
+	if err := xc.Call(context.Background(), "Foo.Sum", Args{1, 2}, &reply); err == nil || foo.Calls() != 0 {
+		t.Fatalf("expect the dead node's error without retry, got %v with %d calls", err, foo.Calls())
+	}
+	if xc.retry != nil {
+		t.Fatal("expect no retry policy by default")
+	}
+}
+
+func TestFailMode(t *testing.T) {
+	tests := []struct {
+		mode      FailMode
+		wantErr   bool
+		wantCalls int //可用节点收到的请求数
+	}{
+		{Failover, false, 1}, //没有设置重试策略时使用DefaultRetryPolicy
+		{Failfast, true, 0},
+		{Failtry, true, 0}, //一直在第一次选择的节点重试
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode.String(), func(t *testing.T) {
+			foo := &Foo{}
+			addr, _ := startServer(t, foo)
+			xc := NewXClient(deadFirst(t, addr), RoundRobinSelect, nil, WithFailMode(tt.mode))
+			defer xc.Close()
+
+			var reply int
+			err := xc.Call(context.Background(), "Foo.Sum", Args{1, 2}, &reply)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expect error %v, got %v", tt.wantErr, err)
+			}
+			if foo.Calls() != tt.wantCalls {
+				t.Fatalf("expect %d calls on live server, got %d", tt.wantCalls, foo.Calls())
+			}
+		})
+	}
+}
+
+func TestFailbackup(t *testing.T) {
+	t.Run("backup wins", func(t *testing.T) {
+		slow, fast := &Foo{delay: 300 * time.Millisecond}, &Foo{}
+		slowAddr, _ := startServer(t, slow)
+		fastAddr, _ := startServer(t, fast)
+		d := NewWeightedDiscovery([]WeightedServer{{Addr: slowAddr, Weight: 2}, {Addr: fastAddr, Weight: 1}})
+		xc := NewXClient(d, RoundRobinSelect, nil, WithFailMode(Failbackup), WithBackupLatency(20*time.Millisecond))
+		defer xc.Close()
+
+		start := time.Now()
+		var reply int
+		if err := xc.Call(context.Background(), "Foo.Sum", Args{1, 2}, &reply); err != nil || reply != 3 {
+			t.Fatalf("expect 3, got %d %v", reply, err)
+		}
+		if elapsed := time.Since(start); elapsed > 200*time.Millisecond {
+			t.Fatalf("expect backup result, took %s", elapsed)
+		}
+		if slow.Calls() != 1 || fast.Calls() != 1 {
+			t.Fatalf("expect one call on each server, got %d %d", slow.Calls(), fast.Calls())
+		}
+	})
+
+	t.Run("never reuse primary", func(t *testing.T) {
+		foo := &Foo{delay: 100 * time.Millisecond}
+		addr, _ := startServer(t, foo)
+		xc := NewXClient(NewMultiServersDiscovery([]string{addr}), RandomSelect, nil, WithFailMode(Failbackup), WithBackupLatency(10*time.Millisecond))
+		defer xc.Close()
+
+		var reply int
+		if err := xc.Call(context.Background(), "Foo.Sum", Args{1, 2}, &reply); err != nil {
+			t.Fatal(err)
+		}
+		if foo.Calls() != 1 {
+			t.Fatalf("expect no backup sent to the primary, got %d calls", foo.Calls())
+		}
+	})
+}
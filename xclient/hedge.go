@@ -0,0 +1,154 @@
+package xclient
+
+import (
+	"context"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// HedgePolicy 对延迟敏感的幂等方法发送对冲请求：第一个请求超过该方法最近延迟的Percentile分位数还没有返回时，
+// 向另一个节点发送相同的请求，使用先成功的结果并取消另一个
+type HedgePolicy struct {
+	Methods    []string      //开启对冲的方法，这些方法必须是幂等的；为空时使用重试策略中的IdempotentMethods
+	Percentile float64       //触发对冲的延迟分位数，默认0.95
+	MinDelay   time.Duration //对冲前最少等待的时间，避免延迟很低时几乎每个请求都对冲
+	MinSamples int           //样本数少于该值时不对冲，默认20
+	MaxRatio   float64       //对冲请求数占请求总数的比例上限，默认0.1
+}
+
+// WithHedging 开启对冲请求，对冲作用于每一次尝试，失败后仍然按FailMode和重试策略处理
+// Failbackup模式本身会发送备份请求，不再对冲
+func WithHedging(p HedgePolicy) XClientOption {
+	return func(xc *XClient) {
+		xc.hedge = newHedger(p)
+	}
+}
+
+const (
+	latencyWindowSize = 128 //每个方法保留最近的样本数
+	maxHedgeTokens    = 10  //允许短时间内集中对冲的数量
+)
+
+// latencyWindow 环形缓冲区保存最近的成功请求延迟
+type latencyWindow struct {
+	samples []time.Duration
+	next    int
+}
+
+func (w *latencyWindow) add(d time.Duration) {
+	if len(w.samples) < latencyWindowSize {
+		w.samples = append(w.samples, d)
+		return
+	}
+	w.samples[w.next] = d
+	w.next = (w.next + 1) % latencyWindowSize
+}
+
+func (w *latencyWindow) percentile(p float64) time.Duration {
+	sorted := make([]time.Duration, len(w.samples))
+	copy(sorted, w.samples)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	idx := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if idx < 0 {
+		idx = 0
+	}
+	return sorted[idx]
+}
+
+type hedger struct {
+	policy  HedgePolicy
+	methods map[string]bool
+
+	mu      sync.Mutex // protect following
+	windows map[string]*latencyWindow
+	tokens  float64 //每个请求补充MaxRatio个，每次对冲消耗1个
+}
+
+func newHedger(p HedgePolicy) *hedger {
+	if p.Percentile <= 0 || p.Percentile > 1 {
+		p.Percentile = 0.95
+	}
+	if p.MinSamples <= 0 {
+		p.MinSamples = 20
+	}
+	if p.MaxRatio <= 0 {
+		p.MaxRatio = 0.1
+	}
+	h := &hedger{
+		policy:  p,
+		methods: make(map[string]bool),
+		windows: make(map[string]*latencyWindow),
+	}
+	for _, m := range p.Methods {
+		h.methods[m] = true
+	}
+	return h
+}
+
+// useIdempotent Methods为空时只对冲重试策略中声明为幂等的方法，都没有时不对冲
+func (h *hedger) useIdempotent(r *retrier) {
+	if len(h.methods) > 0 || r == nil {
+		return
+	}
+	for m := range r.idempotent {
+		h.methods[m] = true
+	}
+}
+
+func (h *hedger) enabled(serviceMethod string) bool {
+	return h.methods[serviceMethod]
+}
+
+// hedging 方法开启了对冲，Failbackup模式不对冲
+func (xc *XClient) hedging(serviceMethod string) bool {
+	return xc.hedge != nil && xc.failMode != Failbackup && xc.hedge.enabled(serviceMethod)
+}
+
+// tryOnce 一次尝试，开启对冲的方法超过延迟分位数时向另一个没有尝试过的节点发送对冲请求
+func (xc *XClient) tryOnce(ctx context.Context, rpcAddr string, attempt int, tried map[string]bool, serviceMethod string, args, reply interface{}) error {
+	if !xc.hedging(serviceMethod) {
+		return xc.attempt(ctx, rpcAddr, attempt, serviceMethod, args, reply)
+	}
+	delay, _ := xc.hedge.delay(serviceMethod) //样本不足时为0，只发送一个请求并记录延迟
+	return xc.callBackup(ctx, rpcAddr, attempt, tried, serviceMethod, args, reply, delay, xc.hedge)
+}
+
+func (h *hedger) observe(serviceMethod string, d time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	w, ok := h.windows[serviceMethod]
+	if !ok {
+		w = &latencyWindow{}
+		h.windows[serviceMethod] = w
+	}
+	w.add(d)
+}
+
+// delay 返回发送对冲请求前等待的时间，样本不足时返回false，同时为本次请求补充对冲令牌
+func (h *hedger) delay(serviceMethod string) (time.Duration, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.tokens = math.Min(maxHedgeTokens, h.tokens+h.policy.MaxRatio)
+	w, ok := h.windows[serviceMethod]
+	if !ok || len(w.samples) < h.policy.MinSamples {
+		return 0, false
+	}
+	d := w.percentile(h.policy.Percentile)
+	if d < h.policy.MinDelay {
+		d = h.policy.MinDelay
+	}
+	return d, true
+}
+
+// allow 对冲比例没有超过上限时消耗一个令牌并返回true
+func (h *hedger) allow() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.tokens < 1 {
+		return false
+	}
+	h.tokens--
+	return true
+}
@@ -0,0 +1,98 @@
+package xclient
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestHedgeMethods(t *testing.T) {
+	tests := []struct {
+		name   string
+		opts   []XClientOption
+		method string
+		expect bool
+	}{
+		{"listed", []XClientOption{WithHedging(HedgePolicy{Methods: []string{"Foo.Get"}})}, "Foo.Get", true},
+		{"not listed", []XClientOption{WithHedging(HedgePolicy{Methods: []string{"Foo.Get"}})}, "Foo.Set", false},
+		{"empty means none", []XClientOption{WithHedging(HedgePolicy{})}, "Foo.Get", false},
+		{"empty uses idempotent methods", []XClientOption{
+			WithHedging(HedgePolicy{}),
+			WithRetryPolicy(RetryPolicy{MaxAttempts: 2, IdempotentMethods: []string{"Foo.Get"}}),
+		}, "Foo.Get", true},
+		{"not idempotent", []XClientOption{
+			WithHedging(HedgePolicy{}),
+			WithRetryPolicy(RetryPolicy{MaxAttempts: 2, IdempotentMethods: []string{"Foo.Get"}}),
+		}, "Foo.Set", false},
+		{"failbackup does not hedge", []XClientOption{
+			WithHedging(HedgePolicy{Methods: []string{"Foo.Get"}}),
+			WithFailMode(Failbackup),
+		}, "Foo.Get", false},
+	}
+	for _, tt := range tests {
+		xc := NewXClient(NewMultiServersDiscovery(nil), RandomSelect, nil, tt.opts...)
+		if got := xc.hedging(tt.method); got != tt.expect {
+			t.Errorf("%s: expect %v, got %v", tt.name, tt.expect, got)
+		}
+	}
+}
+
+// 第一个请求慢时向另一个节点发送对冲请求
+func TestHedgeSlowPrimary(t *testing.T) {
+	slow, fast := &Foo{delay: 500 * time.Millisecond}, &Foo{}
+	slowAddr, _ := startServer(t, slow)
+	fastAddr, _ := startServer(t, fast)
+	//轮询顺序为 slow fast slow
+	d := NewWeightedDiscovery([]WeightedServer{{Addr: slowAddr, Weight: 2}, {Addr: fastAddr, Weight: 1}})
+	xc := NewXClient(d, RoundRobinSelect, nil, WithFailMode(Failfast), WithHedging(HedgePolicy{
+		Methods:    []string{"Foo.Sum"},
+		Percentile: 0.5,
+		MinDelay:   20 * time.Millisecond,
+		MinSamples: 1,
+		MaxRatio:   1,
+	}))
+	defer xc.Close()
+
+	var reply int
+	for i := 0; i < 2; i++ {
+		if err := xc.Call(context.Background(), "Foo.Sum", Args{1, 2}, &reply); err != nil {
+			t.Fatal(err)
+		}
+	}
+	start := time.Now()
+	if err := xc.Call(context.Background(), "Foo.Sum", Args{1, 2}, &reply); err != nil || reply != 3 {
+		t.Fatalf("expect 3, got %d %v", reply, err)
+	}
+	if elapsed := time.Since(start); elapsed > 300*time.Millisecond {
+		t.Fatalf("expect hedged result, took %s", elapsed)
+	}
+	if slow.Calls() != 2 || fast.Calls() != 2 {
+		t.Fatalf("expect 2 calls on each server, got slow %d fast %d", slow.Calls(), fast.Calls())
+	}
+}
+
+// 对冲的方法失败后仍然按FailMode和重试策略处理
+func TestHedgeFollowsFailMode(t *testing.T) {
+	tests := []struct {
+		mode    FailMode
+		wantErr bool
+	}{
+		{Failover, false},
+		{Failfast, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode.String(), func(t *testing.T) {
+			foo := &Foo{}
+			addr, _ := startServer(t, foo)
+			xc := NewXClient(deadFirst(t, addr), RoundRobinSelect, nil, WithFailMode(tt.mode),
+				WithHedging(HedgePolicy{Methods: []string{"Foo.Sum"}}))
+			defer xc.Close()
+
+			var reply int
+			err := xc.Call(context.Background(), "Foo.Sum", Args{1, 2}, &reply)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expect error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,177 @@
+package xclient
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// LoadStats 负载感知的选择策略使用的实时统计，由XClient根据连接池维护
+type LoadStats interface {
+	Pending(addr string) int //地址上缓存的连接中未完成的调用数
+}
+
+const (
+	ewmaDecay      = 10 * time.Second //EWMA的时间常数，越大对历史延迟记得越久
+	failurePenalty = time.Second      //失败的调用按至少这么长的延迟记录，避免快速失败的节点吸走流量
+)
+
+// peakEWMA 延迟高于当前值时直接取峰值，低于时按时间衰减，对变慢的节点反应快，恢复慢
+// 读取时按距离上次记录的时间向0衰减，一次失败或变慢的节点没有流量之后也能重新被选中
+type peakEWMA struct {
+	value float64 //纳秒
+	stamp time.Time
+}
+
+func (e *peakEWMA) observe(rtt time.Duration, now time.Time) {
+	v := float64(rtt)
+	if e.stamp.IsZero() || v > e.get(now) {
+		e.value = v
+	} else {
+		w := math.Exp(-float64(now.Sub(e.stamp)) / float64(ewmaDecay))
+		e.value = e.value*w + v*(1-w)
+	}
+	e.stamp = now
+}
+
+// get 返回按时间衰减后的延迟
+func (e *peakEWMA) get(now time.Time) float64 {
+	if e.stamp.IsZero() {
+		return 0
+	}
+	return e.value * math.Exp(-float64(now.Sub(e.stamp))/float64(ewmaDecay))
+}
+
+// loadStats XClient维护的LoadStats实现
+type loadStats struct {
+	xc *XClient
+}
+
+var _ LoadStats = (*loadStats)(nil)
+
+func (s *loadStats) Pending(addr string) int {
+	s.xc.mu.Lock()
+	p, ok := s.xc.pools[addr]
+	s.xc.mu.Unlock()
+	if !ok {
+		return 0
+	}
+	return p.stats().Pending
+}
+
+// noLoad 没有实时负载时使用，比如直接调用Discovery.Get
+type noLoad struct{}
+
+func (noLoad) Pending(string) int { return 0 }
+
+// leastPendingBalancer 选择未完成调用数最少的实例
+type leastPendingBalancer struct {
+	mu      sync.Mutex // protect following
+	r       *rand.Rand
+	servers []string
+}
+
+func (b *leastPendingBalancer) Update(servers []WeightedServer) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.servers = addrs(servers)
+}
+
+func (b *leastPendingBalancer) Pick(info CallInfo) (string, error) {
+	b.mu.Lock()
+	n := len(b.servers)
+	if n == 0 {
+		b.mu.Unlock()
+		return "", errNoServers
+	}
+	//从随机位置开始，未完成调用数相同时不总是集中到第一个实例
+	start := b.r.Intn(n)
+	servers := b.servers
+	b.mu.Unlock()
+
+	best, bestPending := "", 0
+	for i := 0; i < n; i++ {
+		addr := servers[(start+i)%n]
+		if pending := info.Stats.Pending(addr); best == "" || pending < bestPending {
+			best, bestPending = addr, pending
+		}
+	}
+	return best, nil
+}
+
+func (b *leastPendingBalancer) Report(string, time.Duration, error) {}
+
+// p2cBalancer 随机选两个实例，选择 峰值EWMA延迟 * (未完成调用数 + 1) 更小的
+type p2cBalancer struct {
+	mu      sync.Mutex // protect following
+	r       *rand.Rand
+	servers []string
+	latency map[string]*peakEWMA //只包含当前列表中的实例
+}
+
+func newP2CBalancer() *p2cBalancer {
+	return &p2cBalancer{r: newRand(), latency: make(map[string]*peakEWMA)}
+}
+
+// Update 保留仍在列表中的实例的延迟，删除已经下线的实例
+func (b *p2cBalancer) Update(servers []WeightedServer) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.servers = addrs(servers)
+	latency := make(map[string]*peakEWMA, len(servers))
+	for _, s := range servers {
+		if e, ok := b.latency[s.Addr]; ok {
+			latency[s.Addr] = e
+		} else {
+			latency[s.Addr] = &peakEWMA{}
+		}
+	}
+	b.latency = latency
+}
+
+func (b *p2cBalancer) Pick(info CallInfo) (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	n := len(b.servers)
+	if n == 0 {
+		return "", errNoServers
+	}
+	i := b.r.Intn(n)
+	if n == 1 {
+		return b.servers[i], nil
+	}
+	j := b.r.Intn(n - 1)
+	if j >= i {
+		j++
+	}
+	//没有延迟样本的节点代价为0，优先获得流量
+	x, y := b.servers[i], b.servers[j]
+	now := time.Now()
+	if b.costLocked(info.Stats, y, now) < b.costLocked(info.Stats, x, now) {
+		return y, nil
+	}
+	return x, nil
+}
+
+func (b *p2cBalancer) costLocked(stats LoadStats, addr string, now time.Time) float64 {
+	var latency float64
+	if e, ok := b.latency[addr]; ok {
+		latency = e.get(now)
+	}
+	return latency * float64(stats.Pending(addr)+1)
+}
+
+// Report 失败的调用按failurePenalty记录，被限流和服务不存在的错误不说明节点变慢，按实际延迟记录
+// 已经从列表中删除的实例不再记录，调用返回时实例可能已经下线
+func (b *p2cBalancer) Report(addr string, rtt time.Duration, err error) {
+	if classify(context.Background(), err) == breakerFailure && rtt < failurePenalty {
+		rtt = failurePenalty
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if e, ok := b.latency[addr]; ok {
+		e.observe(rtt, time.Now())
+	}
+}
@@ -0,0 +1,133 @@
+package xclient
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	goRPC "github.com/wjh791072385/gorpc"
+)
+
+// fakeLoad 固定的未完成调用数
+type fakeLoad map[string]int
+
+func (l fakeLoad) Pending(addr string) int { return l[addr] }
+
+func TestPeakEWMA(t *testing.T) {
+	type sample struct {
+		rtt time.Duration
+		at  time.Duration //相对开始的时间
+	}
+	tests := []struct {
+		name    string
+		samples []sample
+		readAt  time.Duration
+		expect  time.Duration
+	}{
+		{"empty", nil, 0, 0},
+		{"single", []sample{{100 * time.Millisecond, 0}}, 0, 100 * time.Millisecond},
+		{"peak", []sample{{100 * time.Millisecond, 0}, {200 * time.Millisecond, time.Second}}, time.Second, 200 * time.Millisecond},
+		{"decay on read", []sample{{100 * time.Millisecond, 0}}, ewmaDecay, time.Duration(float64(100*time.Millisecond) * math.Exp(-1))},
+		{"penalty fades", []sample{{failurePenalty, 0}}, 6 * ewmaDecay, time.Duration(float64(failurePenalty) * math.Exp(-6))},
+	}
+	start := time.Now()
+	for _, tt := range tests {
+		e := &peakEWMA{}
+		for _, s := range tt.samples {
+			e.observe(s.rtt, start.Add(s.at))
+		}
+		got := time.Duration(e.get(start.Add(tt.readAt)))
+		if diff := got - tt.expect; diff < -time.Microsecond || diff > time.Microsecond {
+			t.Errorf("%s: expect %s, got %s", tt.name, tt.expect, got)
+		}
+	}
+}
+
+func TestP2CPick(t *testing.T) {
+	errFailed := errors.New("failed")
+	tests := []struct {
+		name    string
+		rtt     map[string]time.Duration
+		err     map[string]error
+		age     map[string]time.Duration //把延迟样本的时间往前移，模拟一段时间没有流量
+		pending fakeLoad
+		expect  string
+	}{
+		{name: "lower latency", rtt: map[string]time.Duration{"a": 10 * time.Millisecond, "b": 20 * time.Millisecond}, expect: "a"},
+		{name: "pending", rtt: map[string]time.Duration{"a": 10 * time.Millisecond, "b": 20 * time.Millisecond}, pending: fakeLoad{"a": 3}, expect: "b"},
+		{name: "no samples", rtt: map[string]time.Duration{"b": time.Millisecond}, expect: "a"},
+		{name: "failure penalty", rtt: map[string]time.Duration{"a": time.Millisecond, "b": 100 * time.Millisecond}, err: map[string]error{"a": errFailed}, expect: "b"},
+		{
+			name:   "business error not penalized",
+			rtt:    map[string]time.Duration{"a": time.Millisecond, "b": 100 * time.Millisecond},
+			err:    map[string]error{"a": &goRPC.Error{Code: goRPC.CodeUnknown, Message: "user not found"}},
+			expect: "a",
+		},
+		{
+			name:   "penalty decays",
+			rtt:    map[string]time.Duration{"a": time.Millisecond, "b": 100 * time.Millisecond},
+			err:    map[string]error{"a": errFailed},
+			age:    map[string]time.Duration{"a": 6 * ewmaDecay},
+			expect: "a",
+		},
+	}
+	for _, tt := range tests {
+		b := newP2CBalancer()
+		b.Update(servers("a", "b"))
+		for addr, rtt := range tt.rtt {
+			b.Report(addr, rtt, tt.err[addr])
+		}
+		for addr, age := range tt.age {
+			b.latency[addr].stamp = b.latency[addr].stamp.Add(-age)
+		}
+		pending := tt.pending
+		if pending == nil {
+			pending = fakeLoad{}
+		}
+		//只有两个实例时每次都比较这两个
+		for i := 0; i < 10; i++ {
+			if addr, _ := b.Pick(CallInfo{Stats: pending}); addr != tt.expect {
+				t.Fatalf("%s: expect %s, got %s", tt.name, tt.expect, addr)
+			}
+		}
+	}
+}
+
+func TestP2CReportRemoved(t *testing.T) {
+	b := newP2CBalancer()
+	b.Update(servers("a", "b"))
+	b.Report("a", time.Millisecond, nil)
+	b.Report("c", time.Millisecond, nil) //不在列表中
+	b.Update(servers("a"))
+	b.Report("b", time.Millisecond, nil) //已经删除
+	if len(b.latency) != 1 {
+		t.Fatalf("expect latency only for a, got %v", b.latency)
+	}
+	if e := b.latency["a"]; e.stamp.IsZero() {
+		t.Fatal("expect latency of a kept across Update")
+	}
+}
+
+func TestLeastPendingPick(t *testing.T) {
+	tests := []struct {
+		pending fakeLoad
+		expect  string
+	}{
+		{fakeLoad{"a": 2, "b": 0, "c": 1}, "b"},
+		{fakeLoad{"a": 1, "b": 3, "c": 2}, "a"},
+		{fakeLoad{"a": 5, "b": 5}, "c"}, //没有调用的地址为0
+	}
+	b := &leastPendingBalancer{r: newRand()}
+	if _, err := b.Pick(CallInfo{Stats: fakeLoad{}}); err != errNoServers {
+		t.Fatalf("expect errNoServers, got %v", err)
+	}
+	b.Update(servers("a", "b", "c"))
+	for _, tt := range tests {
+		for i := 0; i < 10; i++ {
+			if addr, _ := b.Pick(CallInfo{Stats: tt.pending}); addr != tt.expect {
+				t.Fatalf("pending %v: expect %s, got %s", tt.pending, tt.expect, addr)
+			}
+		}
+	}
+}
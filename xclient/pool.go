@@ -0,0 +1,252 @@
+package xclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	goRPC "github.com/wjh791072385/gorpc"
+)
+
+// WithPoolSize 每个地址最多建立的连接数，默认1。连接按需建立：已有连接都有未完成的调用时才新建
+func WithPoolSize(n int) XClientOption {
+	return func(xc *XClient) {
+		if n > 0 {
+			xc.poolSize = n
+		}
+	}
+}
+
+// WithPoolIdleTimeout 连接超过该时间没有被使用时关闭，0表示不关闭
+// 后台每隔一半的时间检查一次，不再有调用的地址上的连接也会被关闭
+func WithPoolIdleTimeout(d time.Duration) XClientOption {
+	return func(xc *XClient) {
+		xc.poolIdleTimeout = d
+	}
+}
+
+// WithDialFailureTTL 拨号失败后的这段时间内，对该地址的调用直接返回上次的错误，不再重复拨号，默认1秒
+func WithDialFailureTTL(d time.Duration) XClientOption {
+	return func(xc *XClient) {
+		xc.dialFailureTTL = d
+	}
+}
+
+const defaultDialFailureTTL = time.Second
+
+var (
+	errPoolClosed   = errors.New("rpc xclient: connection pool is closed")
+	errClientClosed = errors.New("rpc xclient: client is closed")
+)
+
+// PoolStats 单个地址连接池的统计信息
+type PoolStats struct {
+	Conns   int    //当前连接数
+	Pending int    //所有连接上未完成的调用数
+	Dials   uint64 //累计建立的连接数
+	Evicted uint64 //因为空闲或者不可用被关闭的连接数
+}
+
+type pooledConn struct {
+	client   *goRPC.Client
+	lastUsed time.Time
+}
+
+// dialCall 正在进行的拨号，同一地址的并发调用共享同一次拨号的结果
+type dialCall struct {
+	done   chan struct{}
+	client *goRPC.Client
+	err    error
+}
+
+// connPool 单个地址的连接池，选择未完成调用最少的连接
+// 拨号不持有锁，不会阻塞已经有可用连接的调用
+type connPool struct {
+	addr        string
+	opt         *goRPC.Option
+	size        int
+	idleTimeout time.Duration
+	failureTTL  time.Duration
+	logger      goRPC.Logger
+
+	mu          sync.Mutex // protect following
+	conns       []*pooledConn
+	dialing     *dialCall
+	failedUntil time.Time //拨号失败的负缓存
+	lastErr     error
+	closed      bool
+	dials       uint64
+	evicted     uint64
+}
+
+func newConnPool(addr string, xc *XClient) *connPool {
+	return &connPool{
+		addr:        addr,
+		opt:         xc.opt,
+		size:        xc.poolSize,
+		idleTimeout: xc.poolIdleTimeout,
+		failureTTL:  xc.dialFailureTTL,
+		logger:      xc.logger,
+	}
+}
+
+// get 返回未完成调用最少的连接
+// 所有连接都忙且未达到上限时在后台新建连接；没有连接时等待拨号完成或ctx结束
+func (p *connPool) get(ctx context.Context) (*goRPC.Client, error) {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil, errPoolClosed
+	}
+	now := time.Now()
+	p.evictLocked(now)
+
+	var best *pooledConn
+	bestPending := 0
+	for _, c := range p.conns {
+		if pending := c.client.Pending(); best == nil || pending < bestPending {
+			best, bestPending = c, pending
+		}
+	}
+	if best != nil {
+		if bestPending > 0 && len(p.conns) < p.size && now.After(p.failedUntil) {
+			p.dialLocked()
+		}
+		best.lastUsed = now
+		p.mu.Unlock()
+		return best.client, nil
+	}
+
+	if now.Before(p.failedUntil) {
+		err := p.lastErr
+		p.mu.Unlock()
+		return nil, fmt.Errorf("rpc xclient: dial %s failed recently: %w", p.addr, err)
+	}
+	dc := p.dialLocked()
+	p.mu.Unlock()
+
+	select {
+	case <-dc.done:
+		return dc.client, dc.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// dialLocked 没有正在进行的拨号时开始拨号，返回正在进行的拨号
+func (p *connPool) dialLocked() *dialCall {
+	if p.dialing != nil {
+		return p.dialing
+	}
+	dc := &dialCall{done: make(chan struct{})}
+	p.dialing = dc
+	go func() {
+		defer close(dc.done)
+		client, err := goRPC.Dial("tcp", p.addr, p.opt)
+
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		p.dialing = nil
+		switch {
+		case err != nil:
+			p.logger.Warn("rpc xclient: dial error", "addr", p.addr, "err", err)
+			p.failedUntil = time.Now().Add(p.failureTTL)
+			p.lastErr = err
+		case p.closed:
+			_ = client.Close()
+			client, err = nil, errPoolClosed
+		default:
+			p.dials++
+			p.conns = append(p.conns, &pooledConn{client: client, lastUsed: time.Now()})
+		}
+		dc.client, dc.err = client, err
+	}()
+	return dc
+}
+
+// evictLocked 关闭不可用的连接和空闲太久的连接
+func (p *connPool) evictLocked(now time.Time) {
+	conns := p.conns[:0]
+	for _, c := range p.conns {
+		idle := p.idleTimeout > 0 && now.Sub(c.lastUsed) > p.idleTimeout && c.client.Pending() == 0
+		if !c.client.IsAvailable() || idle {
+			_ = c.client.Close()
+			p.evicted++
+			continue
+		}
+		conns = append(conns, c)
+	}
+	for i := len(conns); i < len(p.conns); i++ {
+		p.conns[i] = nil
+	}
+	p.conns = conns
+}
+
+// evict 后台定期关闭空闲的连接
+func (p *connPool) evict() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.evictLocked(time.Now())
+}
+
+func (p *connPool) stats() PoolStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	s := PoolStats{Conns: len(p.conns), Dials: p.dials, Evicted: p.evicted}
+	for _, c := range p.conns {
+		s.Pending += c.client.Pending()
+	}
+	return s
+}
+
+func (p *connPool) close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	for _, c := range p.conns {
+		_ = c.client.Close()
+	}
+	p.conns = nil
+}
+
+// reapIdle 定期关闭所有连接池中空闲的连接，Close后退出
+func (xc *XClient) reapIdle(done <-chan struct{}) {
+	t := time.NewTicker(xc.poolIdleTimeout / 2)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+		case <-done:
+			return
+		}
+		xc.mu.Lock()
+		pools := make([]*connPool, 0, len(xc.pools))
+		for _, p := range xc.pools {
+			pools = append(pools, p)
+		}
+		xc.mu.Unlock()
+		for _, p := range pools {
+			p.evict()
+		}
+	}
+}
+
+// PoolStats 返回每个地址连接池的统计信息
+func (xc *XClient) PoolStats() map[string]PoolStats {
+	xc.mu.Lock()
+	addrs := make([]string, 0, len(xc.pools))
+	pools := make([]*connPool, 0, len(xc.pools))
+	for addr, p := range xc.pools {
+		addrs = append(addrs, addr)
+		pools = append(pools, p)
+	}
+	xc.mu.Unlock()
+
+	stats := make(map[string]PoolStats, len(pools))
+	for i, p := range pools {
+		stats[addrs[i]] = p.stats()
+	}
+	return stats
+}
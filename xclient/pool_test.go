@@ -0,0 +1,118 @@
+package xclient
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestConnPool(t *testing.T) {
+	tests := []struct {
+		name      string
+		poolSize  int
+		calls     int //并发调用数
+		wantConns int
+	}{
+		{"default size", 0, 4, 1},
+		{"grow when busy", 2, 4, 2},
+		{"no more than needed", 4, 1, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr, _ := startServer(t, &Foo{delay: 100 * time.Millisecond})
+			xc := NewXClient(NewMultiServersDiscovery([]string{addr}), RandomSelect, nil, WithPoolSize(tt.poolSize))
+			defer xc.Close()
+
+			//第一次调用建立连接，之后的并发调用在连接都忙时才新建连接
+			var reply int
+			if err := xc.Call(context.Background(), "Foo.Sum", Args{1, 2}, &reply); err != nil {
+				t.Fatal(err)
+			}
+			var wg sync.WaitGroup
+			for i := 0; i < tt.calls; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					var reply int
+					if err := xc.Call(context.Background(), "Foo.Sum", Args{1, 2}, &reply); err != nil {
+						t.Error(err)
+					}
+					time.Sleep(10 * time.Millisecond)
+				}()
+				time.Sleep(10 * time.Millisecond)
+			}
+			wg.Wait()
+			if s := xc.PoolStats()[addr]; s.Conns != tt.wantConns || s.Pending != 0 {
+				t.Fatalf("expect %d conns and no pending calls, got %+v", tt.wantConns, s)
+			}
+		})
+	}
+}
+
+func TestConnPoolIdleTimeout(t *testing.T) {
+	addr, _ := startServer(t, &Foo{})
+	xc := NewXClient(NewMultiServersDiscovery([]string{addr}), RandomSelect, nil, WithPoolIdleTimeout(50*time.Millisecond))
+	defer xc.Close()
+
+	var reply int
+	for i := 0; i < 2; i++ {
+		if err := xc.Call(context.Background(), "Foo.Sum", Args{1, 2}, &reply); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	//没有新的调用，后台也会关闭空闲的连接
+	if s := xc.PoolStats()[addr]; s.Dials != 2 || s.Evicted != 2 || s.Conns != 0 {
+		t.Fatalf("expect idle connections evicted without calls, got %+v", s)
+	}
+}
+
+// 服务列表变化时关闭已经下线的地址的连接池
+func TestConnPoolPrune(t *testing.T) {
+	addr1, _ := startServer(t, &Foo{})
+	addr2, _ := startServer(t, &Foo{})
+	d := NewMultiServersDiscovery([]string{addr1, addr2})
+	xc := NewXClient(d, RoundRobinSelect, nil)
+	defer xc.Close()
+
+	var reply int
+	for i := 0; i < 2; i++ {
+		if err := xc.Call(context.Background(), "Foo.Sum", Args{1, 2}, &reply); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := len(xc.PoolStats()); n != 2 {
+		t.Fatalf("expect 2 pools, got %d", n)
+	}
+
+	_ = d.Update([]string{addr1})
+	if err := xc.Call(context.Background(), "Foo.Sum", Args{1, 2}, &reply); err != nil {
+		t.Fatal(err)
+	}
+	stats := xc.PoolStats()
+	if _, ok := stats[addr2]; ok || len(stats) != 1 {
+		t.Fatalf("expect pool of %s pruned, got %v", addr2, stats)
+	}
+}
+
+func TestXClientClose(t *testing.T) {
+	addr, _ := startServer(t, &Foo{})
+	xc := NewXClient(NewMultiServersDiscovery([]string{addr}), RandomSelect, nil)
+
+	var reply int
+	if err := xc.Call(context.Background(), "Foo.Sum", Args{1, 2}, &reply); err != nil {
+		t.Fatal(err)
+	}
+	_ = xc.Close()
+	if _, err := xc.dial(context.Background(), addr); !errors.Is(err, errClientClosed) {
+		t.Fatalf("expect dial rejected after Close, got %v", err)
+	}
+	if err := xc.Call(context.Background(), "Foo.Sum", Args{1, 2}, &reply); err == nil {
+		t.Fatal("expect call to fail after Close")
+	}
+	if n := len(xc.PoolStats()); n != 0 {
+		t.Fatalf("expect no pools after Close, got %d", n)
+	}
+}
@@ -0,0 +1,202 @@
+package xclient
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	goRPC "github.com/wjh791072385/gorpc"
+)
+
+// RetryPolicy XClient.Call的重试策略，Failover模式下每次重试通过Discovery重新选择一个没有尝试过的地址，
+// Failtry模式下在同一个地址重试
+//
+// 非幂等的方法只在请求确定没有执行时重试（连接失败、熔断、限流、服务端正在关闭或者超过并发限制），
+// 幂等的方法对RetryableCodes中的所有错误重试，比如DeadlineExceeded、keepalive超时
+// 两次尝试之间至少等待Backoff，服务端返回RetryAfter时等待更长的那个
+type RetryPolicy struct {
+	MaxAttempts       int           //包括第一次调用，小于等于1表示不重试
+	Backoff           goRPC.Backoff //两次尝试之间的等待时间
+	RetryableCodes    []goRPC.Code  //为空时使用 Unavailable、ResourceExhausted、DeadlineExceeded
+	PerAttemptTimeout time.Duration //每次尝试的超时时间，同时受整个ctx的限制，0表示不单独限制
+	IdempotentMethods []string      //可以安全重复执行的方法，比如 Foo.Get
+
+	//重试预算：令牌上限为BudgetTokens，每次失败扣除1个，每次成功补充BudgetRatio个，
+	//令牌不超过一半时停止重试，避免服务端过载时重试放大流量
+	BudgetTokens float64 //默认10
+	BudgetRatio  float64 //默认0.1
+}
+
+// DefaultRetryPolicy Failover和Failtry模式没有设置WithRetryPolicy时使用，
+// 非幂等的方法只在服务端没有处理请求时重试
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	Backoff:     goRPC.Backoff{Base: 10 * time.Millisecond, Max: 100 * time.Millisecond, Factor: 2, Jitter: 0.2},
+}
+
+// WithRetryPolicy 设置Failover和Failtry模式的重试策略，默认DefaultRetryPolicy
+func WithRetryPolicy(p RetryPolicy) XClientOption {
+	return func(xc *XClient) {
+		xc.retry = newRetrier(p)
+	}
+}
+
+var defaultRetryableCodes = []goRPC.Code{goRPC.CodeUnavailable, goRPC.CodeResourceExhausted, goRPC.CodeDeadlineExceeded}
+
+// rejectedError 请求没有发出就在本地被拒绝：地址上的方法正在被限流，或者地址已经熔断
+type rejectedError struct {
+	err *goRPC.Error
+}
+
+func (e *rejectedError) Error() string { return e.err.Error() }
+
+func (e *rejectedError) Unwrap() error { return e.err }
+
+func rejectedLocally(err error) bool {
+	var r *rejectedError
+	return errors.As(err, &r)
+}
+
+// notProcessed 这些错误表示请求没有执行，非幂等的方法也可以重试：本地拒绝、拨号失败，
+// 以及服务端的拒绝（正在关闭、限流、超过并发限制）
+// keepalive超时时连接上正在进行的调用可能已经执行，虽然也是Unavailable，但不在此列
+func notProcessed(err error) bool {
+	if errors.Is(err, goRPC.ErrKeepaliveTimeout) {
+		return false
+	}
+	code := goRPC.ErrorCode(err)
+	return code == goRPC.CodeUnavailable || code == goRPC.CodeResourceExhausted
+}
+
+type retrier struct {
+	policy     RetryPolicy
+	retryable  map[goRPC.Code]bool
+	idempotent map[string]bool
+
+	mu     sync.Mutex // protect tokens
+	tokens float64
+}
+
+func newRetrier(p RetryPolicy) *retrier {
+	if p.MaxAttempts < 1 {
+		p.MaxAttempts = 1
+	}
+	if len(p.RetryableCodes) == 0 {
+		p.RetryableCodes = defaultRetryableCodes
+	}
+	if p.BudgetTokens <= 0 {
+		p.BudgetTokens = 10
+	}
+	if p.BudgetRatio <= 0 {
+		p.BudgetRatio = 0.1
+	}
+	r := &retrier{
+		policy:     p,
+		retryable:  make(map[goRPC.Code]bool),
+		idempotent: make(map[string]bool),
+		tokens:     p.BudgetTokens,
+	}
+	for _, c := range p.RetryableCodes {
+		r.retryable[c] = true
+	}
+	for _, m := range p.IdempotentMethods {
+		r.idempotent[m] = true
+	}
+	return r
+}
+
+// shouldRetry 错误可以重试且预算足够时返回true
+func (r *retrier) shouldRetry(serviceMethod string, err error) bool {
+	if !r.retryable[goRPC.ErrorCode(err)] || (!r.idempotent[serviceMethod] && !notProcessed(err)) {
+		return false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.tokens > r.policy.BudgetTokens/2
+}
+
+// record 记录每次尝试的结果，更新重试预算；本地拒绝的请求没有发出，不消耗预算
+func (r *retrier) record(err error) {
+	if rejectedLocally(err) {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err == nil {
+		r.tokens = math.Min(r.policy.BudgetTokens, r.tokens+r.policy.BudgetRatio)
+	} else if r.retryable[goRPC.ErrorCode(err)] {
+		r.tokens = math.Max(0, r.tokens-1)
+	}
+}
+
+// wait 第retries次重试之前等待的时间，服务端建议的RetryAfter更长时使用RetryAfter
+func (r *retrier) wait(retries int, err error) time.Duration {
+	d := r.policy.Backoff.Duration(retries)
+	if after := goRPC.RetryAfter(err); after > d {
+		return after
+	}
+	return d
+}
+
+// callWithRetry 每次尝试一个子span，sameAddr为false时重试避开已经尝试过的地址，否则一直使用第一次选择的地址
+func (xc *XClient) callWithRetry(ctx context.Context, serviceMethod string, args, reply interface{}, sameAddr bool) error {
+	r := xc.retry
+	tried := make(map[string]bool)
+	var rpcAddr string
+	var err error
+	for attempt := 0; attempt < r.policy.MaxAttempts; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(r.wait(attempt-1, err)):
+			case <-ctx.Done():
+				return err
+			}
+		}
+
+		if attempt == 0 || !sameAddr {
+			rpcAddr, err = xc.pick(ctx, serviceMethod, args, tried)
+			if err != nil {
+				return err
+			}
+			tried[rpcAddr] = true
+		}
+
+		err = xc.tryOnce(ctx, rpcAddr, attempt, tried, serviceMethod, args, reply)
+		r.record(err)
+		if err == nil || ctx.Err() != nil {
+			return err
+		}
+		if !r.shouldRetry(serviceMethod, err) {
+			return err
+		}
+		xc.logger.Debug("rpc xclient: retry", "method", serviceMethod, "addr", rpcAddr, "attempt", attempt+1, "err", err)
+	}
+	return err
+}
+
+func (xc *XClient) attempt(ctx context.Context, rpcAddr string, attempt int, serviceMethod string, args, reply interface{}) (err error) {
+	ctx, span := xc.tracer().StartSpan(ctx, "XClient.Attempt "+serviceMethod, goRPC.SpanKindInternal)
+	defer func() { span.Finish(err) }()
+	span.SetAttribute("rpc.addr", rpcAddr)
+	span.SetAttribute("rpc.attempt", strconv.Itoa(attempt+1))
+
+	parent := ctx
+	if xc.retry != nil && xc.retry.policy.PerAttemptTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, xc.retry.policy.PerAttemptTimeout)
+		defer cancel()
+	}
+	start := time.Now()
+	err = xc.call(rpcAddr, ctx, serviceMethod, args, reply)
+	if err == nil && xc.hedging(serviceMethod) {
+		xc.hedge.observe(serviceMethod, time.Since(start))
+	}
+	//单次尝试超时而整个调用没有超时，可以重试
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) && parent.Err() == nil && goRPC.ErrorCode(err) == goRPC.CodeUnknown {
+		err = &goRPC.Error{Code: goRPC.CodeDeadlineExceeded, Message: err.Error()}
+	}
+	return err
+}
@@ -0,0 +1,143 @@
+package xclient
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	goRPC "github.com/wjh791072385/gorpc"
+)
+
+// deadAddr 返回一个没有监听的地址
+func deadAddr(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	_ = l.Close()
+	return addr
+}
+
+func TestRetrierShouldRetry(t *testing.T) {
+	r := newRetrier(RetryPolicy{MaxAttempts: 3, IdempotentMethods: []string{"Foo.Get"}})
+	tests := []struct {
+		method string
+		err    error
+		expect bool
+	}{
+		{"Foo.Set", goRPC.ErrServerShutdown, true}, //服务端没有处理，非幂等的方法也可以重试
+		{"Foo.Set", &goRPC.Error{Code: goRPC.CodeResourceExhausted}, true},
+		{"Foo.Set", &rejectedError{&goRPC.Error{Code: goRPC.CodeUnavailable}}, true},
+		{"Foo.Set", &goRPC.Error{Code: goRPC.CodeDeadlineExceeded}, false}, //服务端可能已经执行
+		{"Foo.Set", goRPC.ErrKeepaliveTimeout, false},
+		{"Foo.Get", goRPC.ErrKeepaliveTimeout, true},
+		{"Foo.Get", &goRPC.Error{Code: goRPC.CodeDeadlineExceeded}, true},
+		{"Foo.Get", &goRPC.Error{Code: goRPC.CodeNotFound}, false},
+		{"Foo.Get", errors.New("unknown"), false},
+	}
+	for _, tt := range tests {
+		if got := r.shouldRetry(tt.method, tt.err); got != tt.expect {
+			t.Errorf("%s %v: expect %v, got %v", tt.method, tt.err, tt.expect, got)
+		}
+	}
+}
+
+func TestRetryBudget(t *testing.T) {
+	r := newRetrier(RetryPolicy{MaxAttempts: 3, BudgetTokens: 4, BudgetRatio: 0.5})
+	unavailable := &goRPC.Error{Code: goRPC.CodeUnavailable}
+	tests := []struct {
+		name   string
+		record []error
+		expect bool
+	}{
+		{"full budget", nil, true},
+		{"one failure", []error{unavailable}, true},
+		{"drained to half", []error{unavailable}, false},
+		{"not retryable error does not cost", []error{&goRPC.Error{Code: goRPC.CodeNotFound}}, false},
+		{"local rejection does not cost", []error{&rejectedError{&goRPC.Error{Code: goRPC.CodeResourceExhausted}}}, false},
+		{"refilled by successes", []error{nil}, true},
+	}
+	for _, tt := range tests {
+		for _, err := range tt.record {
+			r.record(err)
+		}
+		if got := r.shouldRetry("Foo.Sum", unavailable); got != tt.expect {
+			t.Fatalf("%s: expect %v, got %v (tokens %.1f)", tt.name, tt.expect, got, r.tokens)
+		}
+	}
+}
+
+// Failover每次重试选择没有尝试过的地址，两次尝试之间按Backoff等待
+func TestCallWithRetry(t *testing.T) {
+	backoff := goRPC.Backoff{Base: 50 * time.Millisecond, Factor: 2}
+	tests := []struct {
+		name     string
+		dead     int //不可用的地址数，排在可用的地址前面
+		live     bool
+		attempts int
+		minWait  time.Duration
+		wantErr  bool
+	}{
+		{"first succeeds", 0, true, 3, 0, false},
+		{"failover to live", 2, true, 3, 150 * time.Millisecond, false},
+		{"attempts exhausted", 3, false, 3, 150 * time.Millisecond, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var servers []string
+			for i := 0; i < tt.dead; i++ {
+				servers = append(servers, deadAddr(t))
+			}
+			foo := &Foo{}
+			if tt.live {
+				addr, _ := startServer(t, foo)
+				servers = append(servers, addr)
+			}
+			//轮询从随机位置开始，使用权重让可用的地址最后被选中
+			ws := make([]WeightedServer, len(servers))
+			for i, addr := range servers {
+				ws[i] = WeightedServer{Addr: addr, Weight: len(servers) - i}
+			}
+			xc := NewXClient(NewWeightedDiscovery(ws), RoundRobinSelect, nil, WithFailMode(Failover),
+				WithRetryPolicy(RetryPolicy{MaxAttempts: tt.attempts, Backoff: backoff}))
+			defer xc.Close()
+
+			start := time.Now()
+			var reply int
+			err := xc.Call(context.Background(), "Foo.Sum", Args{1, 2}, &reply)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expect error %v, got %v", tt.wantErr, err)
+			}
+			if elapsed := time.Since(start); elapsed < tt.minWait {
+				t.Fatalf("expect backoff at least %s, took %s", tt.minWait, elapsed)
+			}
+			if tt.live && foo.Calls() != 1 {
+				t.Fatalf("expect live server called once, got %d", foo.Calls())
+			}
+		})
+	}
+}
+
+// 服务端返回RetryAfter时，重试前等待RetryAfter和Backoff中更长的那个
+func TestRetryWait(t *testing.T) {
+	r := newRetrier(RetryPolicy{MaxAttempts: 3, Backoff: goRPC.Backoff{Base: 10 * time.Millisecond, Factor: 2}})
+	tests := []struct {
+		retries int
+		err     error
+		expect  time.Duration
+	}{
+		{0, goRPC.ErrServerShutdown, 10 * time.Millisecond},
+		{1, goRPC.ErrServerShutdown, 20 * time.Millisecond},
+		{0, &goRPC.Error{Code: goRPC.CodeResourceExhausted, RetryAfter: 300 * time.Millisecond}, 300 * time.Millisecond},
+		{3, &goRPC.Error{Code: goRPC.CodeResourceExhausted, RetryAfter: time.Millisecond}, 80 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		if got := r.wait(tt.retries, tt.err); got != tt.expect {
+			t.Errorf("retries %d err %v: expect %s, got %s", tt.retries, tt.err, tt.expect, got)
+		}
+	}
+}
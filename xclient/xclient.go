@@ -2,82 +2,358 @@ package xclient
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"reflect"
 	"sync"
+	"time"
 
 	goRPC "github.com/wjh791072385/gorpc"
 )
 
 type XClient struct {
-	d       Discovery
-	mode    SelectMode
-	opt     *goRPC.Option
-	mu      sync.Mutex
-	clients map[string]*goRPC.Client
+	d      Discovery
+	opt    *goRPC.Option
+	mu     sync.Mutex
+	pools  map[string]*connPool //每个地址一个连接池
+	closed bool                 //Close之后不再建立新的连接池
+	done   chan struct{}        //Close时关闭，停止后台清理空闲连接
+	logger goRPC.Logger
+
+	poolSize        int
+	poolIdleTimeout time.Duration
+	dialFailureTTL  time.Duration
+	retry           *retrier //Failover和Failtry的重试策略
+	failMode        FailMode
+	backupLatency   time.Duration
+	hedge           *hedger //为nil时不对冲
+	breakerPolicy   *BreakerPolicy
+	hashKey         HashKeyFunc
+	stats           *loadStats //每个地址的实时负载，通过CallInfo提供给Balancer
+	balancer        Balancer   //为nil时表示mode不支持
+
+	balancerMu sync.Mutex       // protect following
+	servers    []WeightedServer //最近一次同步给balancer的服务列表
+	version    uint64           //servers对应的VersionedDiscovery版本号
+
+	breakerMu sync.Mutex
+	breakers  map[string]*breaker
+
+	throttleMu sync.Mutex
+	throttled  map[throttleKey]time.Time //被服务端限流的地址和方法 -> 可以再次调用的时间
+}
+
+// throttleKey 服务端按方法、IP或者主体限流，一个方法被限流时不影响同一个地址上的其他方法
+type throttleKey struct {
+	addr   string
+	method string
 }
 
 var _ io.Closer = (*XClient)(nil)
 
-func NewXClient(d Discovery, mode SelectMode, opt *goRPC.Option) *XClient {
-	return &XClient{d: d, mode: mode, opt: opt, clients: make(map[string]*goRPC.Client)}
+// XClientOption XClient的可选配置
+type XClientOption func(*XClient)
+
+// WithLogger 设置XClient的日志，默认使用goRPC.DefaultLogger
+func WithLogger(logger goRPC.Logger) XClientOption {
+	return func(xc *XClient) {
+		xc.logger = logger
+	}
+}
+
+func NewXClient(d Discovery, mode SelectMode, opt *goRPC.Option, opts ...XClientOption) *XClient {
+	xc := &XClient{
+		d:              d,
+		opt:            opt,
+		pools:          make(map[string]*connPool),
+		logger:         goRPC.DefaultLogger,
+		poolSize:       1,
+		dialFailureTTL: defaultDialFailureTTL,
+		backupLatency:  defaultBackupLatency,
+		throttled:      make(map[throttleKey]time.Time),
+		breakers:       make(map[string]*breaker),
+		done:           make(chan struct{}),
+	}
+	xc.stats = &loadStats{xc: xc}
+	for _, o := range opts {
+		o(xc)
+	}
+	if xc.balancer == nil {
+		xc.balancer = NewBalancer(mode)
+	}
+	if xc.retry == nil && (xc.failMode == Failover || xc.failMode == Failtry) {
+		xc.retry = newRetrier(DefaultRetryPolicy)
+	}
+	if xc.hedge != nil {
+		xc.hedge.useIdempotent(xc.retry)
+	}
+	if xc.poolIdleTimeout > 0 {
+		go xc.reapIdle(xc.done)
+	}
+	return xc
+}
+
+// 追踪使用opt中的Tracer，为nil时不产生span
+func (xc *XClient) tracer() *goRPC.Tracer {
+	if xc.opt == nil {
+		return nil
+	}
+	return xc.opt.Tracer
 }
 
 func (xc *XClient) Close() error {
 	xc.mu.Lock()
 	defer xc.mu.Unlock()
-	for key, client := range xc.clients {
-		_ = client.Close()
-		delete(xc.clients, key)
+	if !xc.closed {
+		close(xc.done)
+	}
+	xc.closed = true
+	for key, p := range xc.pools {
+		p.close()
+		delete(xc.pools, key)
 	}
 	return nil
 }
 
-func (xc *XClient) dial(addr string) (*goRPC.Client, error) {
+// dial 只在查找连接池时持有xc.mu，拨号在连接池中进行，不同地址互不影响
+func (xc *XClient) dial(ctx context.Context, addr string) (*goRPC.Client, error) {
 	xc.mu.Lock()
-	defer xc.mu.Unlock()
+	if xc.closed {
+		xc.mu.Unlock()
+		return nil, errClientClosed
+	}
+	p, ok := xc.pools[addr]
+	if !ok {
+		p = newConnPool(addr, xc)
+		xc.pools[addr] = p
+	}
+	xc.mu.Unlock()
+	return p.get(ctx)
+}
+
+func (xc *XClient) call(rpcAddr string, ctx context.Context, serviceMethod string, args, reply interface{}) error {
+	//服务端要求退避期间不再发送请求
+	if wait := xc.throttledFor(rpcAddr, serviceMethod); wait > 0 {
+		return &rejectedError{&goRPC.Error{
+			Code:       goRPC.CodeResourceExhausted,
+			Message:    fmt.Sprintf("rpc xclient: %s on %s is rate limited, retry after %s", serviceMethod, rpcAddr, wait),
+			RetryAfter: wait,
+		}}
+	}
+
+	b := xc.breakerFor(rpcAddr)
+	if b != nil && !b.allow() {
+		return &rejectedError{&goRPC.Error{Code: goRPC.CodeUnavailable, Message: "rpc xclient: circuit breaker is open for " + rpcAddr}}
+	}
+
+	start := time.Now()
+	client, err := xc.dial(ctx, rpcAddr)
+	if err != nil {
+		//连接失败说明请求没有发出，标记为Unavailable以便重试
+		err = &goRPC.Error{Code: goRPC.CodeUnavailable, Message: fmt.Sprintf("%s is disabled, err : %s", rpcAddr, err)}
+		xc.reportBreaker(ctx, rpcAddr, b, err)
+		xc.report(ctx, rpcAddr, time.Since(start), err)
+		return err
+	}
+	err = client.Call(ctx, serviceMethod, args, reply)
+	xc.reportBreaker(ctx, rpcAddr, b, err)
+	xc.report(ctx, rpcAddr, time.Since(start), err)
+	if wait := goRPC.RetryAfter(err); wait > 0 {
+		xc.throttle(rpcAddr, serviceMethod, wait)
+	}
+	return err
+}
+
+// available 地址上的方法没有被限流，且地址没有熔断
+func (xc *XClient) available(rpcAddr, serviceMethod string) bool {
+	if xc.throttledFor(rpcAddr, serviceMethod) > 0 {
+		return false
+	}
+	b := xc.breakerFor(rpcAddr)
+	return b == nil || b.ready()
+}
+
+func (xc *XClient) throttle(rpcAddr, serviceMethod string, wait time.Duration) {
+	xc.throttleMu.Lock()
+	defer xc.throttleMu.Unlock()
+	xc.throttled[throttleKey{rpcAddr, serviceMethod}] = time.Now().Add(wait)
+}
 
-	client, ok := xc.clients[addr]
-	if ok && !client.IsAvailable() {
-		_ = client.Close()
-		delete(xc.clients, addr)
-		client = nil
+// throttledFor 返回地址上的方法还需要退避的时间
+func (xc *XClient) throttledFor(rpcAddr, serviceMethod string) time.Duration {
+	key := throttleKey{rpcAddr, serviceMethod}
+	xc.throttleMu.Lock()
+	defer xc.throttleMu.Unlock()
+	until, ok := xc.throttled[key]
+	if !ok {
+		return 0
+	}
+	wait := time.Until(until)
+	if wait <= 0 {
+		delete(xc.throttled, key)
+		return 0
+	}
+	return wait
+}
+
+// maxSelectAttempts 选中的地址正在退避或者已经尝试过时，最多重新选择的次数
+const maxSelectAttempts = 3
+
+// get 从Discovery同步服务列表后通过Balancer选择一个地址
+func (xc *XClient) get(ctx context.Context, serviceMethod string, args interface{}, tried map[string]bool) (string, error) {
+	if xc.balancer == nil {
+		return "", errors.New("rpc xclient: not supported select mode")
+	}
+	if err := xc.syncServers(); err != nil {
+		return "", err
+	}
+	return xc.balancer.Pick(CallInfo{
+		Ctx:           ctx,
+		ServiceMethod: serviceMethod,
+		Args:          args,
+		Key:           xc.callKey(ctx, serviceMethod, args),
+		Stats:         xc.stats,
+		Available: func(addr string) bool {
+			return !tried[addr] && xc.available(addr, serviceMethod)
+		},
+	})
+}
+
+// syncServers 服务列表变化时才调用Balancer.Update
+// VersionedDiscovery的版本号没变时直接返回，否则获取整个列表比较
+func (xc *XClient) syncServers() error {
+	var version uint64
+	vd, versioned := xc.d.(VersionedDiscovery)
+	if versioned {
+		//RegistryDiscovery在Refresh中从注册中心更新列表和版本号
+		if err := xc.d.Refresh(); err != nil {
+			return err
+		}
+		version = vd.Version()
+		xc.balancerMu.Lock()
+		same := xc.servers != nil && xc.version == version
+		xc.balancerMu.Unlock()
+		if same {
+			return nil
+		}
 	}
 
-	if client == nil {
-		//如果没有缓存的client,那么重新拨号建立连接
-		var err error
-		client, err = goRPC.Dial("tcp", addr, xc.opt)
+	var servers []WeightedServer
+	if wd, ok := xc.d.(WeightedDiscovery); ok {
+		ws, err := wd.GetAllWeighted()
+		if err != nil {
+			return err
+		}
+		servers = ws
+	} else {
+		addrs, err := xc.d.GetAll()
 		if err != nil {
-			return nil, err
+			return err
 		}
-		xc.clients[addr] = client
+		servers = unweighted(addrs)
 	}
 
-	return client, nil
+	xc.balancerMu.Lock()
+	defer xc.balancerMu.Unlock()
+	xc.version = version
+	if xc.servers != nil && reflect.DeepEqual(xc.servers, servers) {
+		return nil
+	}
+	xc.servers = servers
+	xc.balancer.Update(servers)
+	alive := make(map[string]bool, len(servers))
+	for _, s := range servers {
+		alive[s.Addr] = true
+	}
+	xc.prunePools(alive)
+	xc.pruneBreakers(alive)
+	return nil
 }
 
-func (xc *XClient) call(rpcAddr string, ctx context.Context, serviceMethod string, args, reply interface{}) error {
-	client, err := xc.dial(rpcAddr)
+// prunePools 关闭已经不在服务列表中的地址的连接池
+func (xc *XClient) prunePools(alive map[string]bool) {
+	xc.mu.Lock()
+	defer xc.mu.Unlock()
+	for addr, p := range xc.pools {
+		if !alive[addr] {
+			p.close()
+			delete(xc.pools, addr)
+		}
+	}
+}
+
+// report 把调用结果反馈给Balancer，调用方主动取消的调用不能说明节点的情况
+func (xc *XClient) report(ctx context.Context, rpcAddr string, rtt time.Duration, err error) {
+	if xc.balancer == nil || (err != nil && errors.Is(ctx.Err(), context.Canceled)) {
+		return
+	}
+	xc.balancer.Report(rpcAddr, rtt, err)
+}
+
+// pick 通过Discovery选择地址，尽量避开正在退避、已经熔断和已经尝试过的地址
+func (xc *XClient) pick(ctx context.Context, serviceMethod string, args interface{}, tried map[string]bool) (string, error) {
+	var rpcAddr string
+	for i := 0; i < maxSelectAttempts; i++ {
+		addr, err := xc.get(ctx, serviceMethod, args, tried)
+		if err != nil {
+			return "", err
+		}
+		rpcAddr = addr
+		if !tried[addr] && xc.available(addr, serviceMethod) {
+			return addr, nil
+		}
+	}
+	//按策略多次选择的都是不可用或者尝试过的地址，从所有地址中找一个，第一次选择时也是如此
+	servers, err := xc.d.GetAll()
 	if err != nil {
-		return fmt.Errorf("%s is disabled, err : %s", rpcAddr, err)
+		return "", err
+	}
+	for _, addr := range servers {
+		if !tried[addr] && xc.available(addr, serviceMethod) {
+			return addr, nil
+		}
 	}
-	return client.Call(ctx, serviceMethod, args, reply)
+	return rpcAddr, nil
 }
 
 // Call 通过实现已经实现的Dicover接口中的get方法，得到可用的服务地址
-func (xc *XClient) Call(ctx context.Context, serviceMethod string, args, reply interface{}) error {
-	rpcAddr, err := xc.d.Get(xc.mode)
+// 失败时按FailMode处理，Failover和Failtry按重试策略重试；开启对冲的方法每次尝试都可能发送对冲请求
+func (xc *XClient) Call(ctx context.Context, serviceMethod string, args, reply interface{}) (err error) {
+	ctx, span := xc.tracer().StartSpan(ctx, "XClient.Call "+serviceMethod, goRPC.SpanKindInternal)
+	defer func() { span.Finish(err) }()
+	span.SetAttribute("rpc.fail_mode", xc.failMode.String())
+
+	switch xc.failMode {
+	case Failbackup:
+		primary, err := xc.pick(ctx, serviceMethod, args, nil)
+		if err != nil {
+			return err
+		}
+		return xc.callBackup(ctx, primary, 0, make(map[string]bool), serviceMethod, args, reply, xc.backupLatency, nil)
+	case Failover:
+		return xc.callWithRetry(ctx, serviceMethod, args, reply, false)
+	case Failtry:
+		return xc.callWithRetry(ctx, serviceMethod, args, reply, true)
+	}
+
+	rpcAddr, err := xc.pick(ctx, serviceMethod, args, nil)
 	//log.Println("selected rpcAddr : ", rpcAddr)
 	if err != nil {
 		return err
 	}
+	span.SetAttribute("rpc.addr", rpcAddr)
+	if xc.hedging(serviceMethod) {
+		return xc.tryOnce(ctx, rpcAddr, 0, make(map[string]bool), serviceMethod, args, reply)
+	}
 	return xc.call(rpcAddr, ctx, serviceMethod, args, reply)
 }
 
 // Broadcast 实现广播方法，对所有服务进行调用
-func (xc *XClient) Broadcast(ctx context.Context, serviceMethod string, args, reply interface{}) error {
+func (xc *XClient) Broadcast(ctx context.Context, serviceMethod string, args, reply interface{}) (err error) {
+	ctx, span := xc.tracer().StartSpan(ctx, "XClient.Broadcast "+serviceMethod, goRPC.SpanKindInternal)
+	defer func() { span.Finish(err) }()
+
 	servers, err := xc.d.GetAll()
 	if err != nil {
 		return err
@@ -87,6 +363,7 @@ func (xc *XClient) Broadcast(ctx context.Context, serviceMethod string, args, re
 	var e error
 	replyDone := reply == nil // if reply is nil, don't need to set value
 	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 	for _, rpcAddr := range servers {
 		wg.Add(1)
 		go func(rpcAddr string) {
@@ -95,7 +372,11 @@ func (xc *XClient) Broadcast(ctx context.Context, serviceMethod string, args, re
 			if reply != nil {
 				clonedReply = reflect.New(reflect.ValueOf(reply).Elem().Type()).Interface()
 			}
+			//每个实例一个子span，便于查看广播的扇出情况
+			ctx, span := xc.tracer().StartSpan(ctx, "XClient.Broadcast "+serviceMethod, goRPC.SpanKindInternal)
+			span.SetAttribute("rpc.addr", rpcAddr)
 			err := xc.call(rpcAddr, ctx, serviceMethod, args, clonedReply)
+			span.Finish(err)
 			mu.Lock()
 			if err != nil && e == nil {
 				e = err
@@ -0,0 +1,83 @@
+package xclient
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	goRPC "github.com/wjh791072385/gorpc"
+)
+
+type Args struct{ Num1, Num2 int }
+
+// Foo 测试服务，delay模拟处理耗时，calls记录收到的请求数
+type Foo struct {
+	delay time.Duration
+	calls int64
+}
+
+func (f *Foo) Sum(args Args, reply *int) error {
+	atomic.AddInt64(&f.calls, 1)
+	time.Sleep(f.delay)
+	*reply = args.Num1 + args.Num2
+	return nil
+}
+
+// Fail 返回业务错误，服务端本身是正常的
+func (f *Foo) Fail(args Args, reply *int) error {
+	atomic.AddInt64(&f.calls, 1)
+	return errors.New("user not found")
+}
+
+func (f *Foo) Calls() int {
+	return int(atomic.LoadInt64(&f.calls))
+}
+
+// startServer 在随机端口启动一个注册了foo的Server，返回地址
+func startServer(t *testing.T, foo *Foo, opts ...goRPC.ServerOption) (string, *goRPC.Server) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := goRPC.NewServer(opts...)
+	if foo != nil {
+		if err := server.Register(foo); err != nil {
+			t.Fatal(err)
+		}
+	}
+	go server.Accept(l)
+	t.Cleanup(func() { _ = l.Close() })
+	return l.Addr().String(), server
+}
+
+// 一个方法被服务端限流时，同一个地址上的其他方法不受影响
+func TestThrottlePerMethod(t *testing.T) {
+	addr, server := startServer(t, &Foo{})
+	_ = server.SetRateLimit(goRPC.RateLimitRule{By: goRPC.RateLimitByMethod, Method: "Foo.Sum", Rate: 0.1, Burst: 1})
+	//不重试，被限流的调用直接返回错误
+	xc := NewXClient(NewMultiServersDiscovery([]string{addr}), RandomSelect, nil, WithFailMode(Failfast))
+	defer xc.Close()
+
+	ctx := context.Background()
+	var reply int
+	if err := xc.Call(ctx, "Foo.Sum", Args{1, 2}, &reply); err != nil {
+		t.Fatal(err)
+	}
+	if err := xc.Call(ctx, "Foo.Sum", Args{1, 2}, &reply); goRPC.RetryAfter(err) <= 0 {
+		t.Fatalf("expect rate limited with RetryAfter, got %v", err)
+	}
+	if xc.available(addr, "Foo.Sum") {
+		t.Fatal("expect Foo.Sum throttled")
+	}
+	if !xc.available(addr, "Health.Check") {
+		t.Fatal("expect other methods on the same address not throttled")
+	}
+	var health goRPC.HealthCheckResponse
+	if err := xc.Call(ctx, "Health.Check", goRPC.HealthCheckRequest{}, &health); err != nil {
+		t.Fatalf("expect Health.Check not throttled, got %v", err)
+	}
+}